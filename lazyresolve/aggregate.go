@@ -0,0 +1,22 @@
+package lazyresolve
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+)
+
+// NewAggregateResolver returns a resolver of values computed per key by a grouped query,
+// e.g. SELECT post_id, COUNT(*) ... GROUP BY post_id. resolve returns the aggregates by key;
+// a key missing from them, i.e. without rows, resolves to the zero value of Agg.
+func NewAggregateResolver[Agg any, Key comparable](name string, resolve func(ctx context.Context, keys []Key) (map[Key]Agg, error), opts ...ResolverOption) Resolver[Agg, Key] {
+	return NewResolver(name, func(ctx context.Context, keys []Key) ([]Agg, error) {
+		aggs, err := resolve(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		return lo.Map(keys, func(key Key, _ int) Agg {
+			return aggs[key]
+		}), nil
+	}, opts...)
+}
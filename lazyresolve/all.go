@@ -0,0 +1,47 @@
+package lazyresolve
+
+import "iter"
+
+// All returns an iterator over the values r has resolved and still caches, e.g. to render a
+// summary of the users a response refers to:
+//
+//	for u := range userResolver.All() {
+//		names = append(names, u.Name)
+//	}
+//
+// Pending futures are not resolved, so resolve r first to include their values. Values dropped by
+// WithFilter are yielded as the zero value of T like futures resolve to, and the order is
+// unspecified. The values are those cached when iteration starts.
+func (r *resolverImpl[T, Key]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, v := range r.snapshot() {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// snapshot copies the cached values, so that they are yielded without the lock held by callers
+// creating futures.
+func (r *resolverImpl[T, Key]) snapshot() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var values []T
+	for _, v := range r.store.all() {
+		values = append(values, v.value)
+	}
+	return values
+}
+
+// All yields cont applied to the values of the source resolver, which include those of keys
+// requested other than through LoadThen.
+func (m *mappedResolver[T, U, Key]) All() iter.Seq[U] {
+	return func(yield func(U) bool) {
+		for v := range m.Resolver.All() {
+			if !yield(m.cont(v)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package lazyresolve
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func newSquareResolver() Resolver[int, int] {
+	return NewResolver("square", func(_ context.Context, keys []int) ([]int, error) {
+		values := make([]int, len(keys))
+		for i, k := range keys {
+			values[i] = k * k
+		}
+		return values, nil
+	})
+}
+
+func TestAll(t *testing.T) {
+	r := newSquareResolver()
+	for k := 1; k <= 3; k++ {
+		r.Future(k)
+	}
+	if got := slices.Collect(r.All()); len(got) != 0 {
+		t.Errorf("pending values yielded: %v", got)
+	}
+	if err := r.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := slices.Sorted(r.All()); !slices.Equal(got, []int{1, 4, 9}) {
+		t.Errorf("All() = %v, want [1 4 9]", got)
+	}
+	for range r.All() {
+		break
+	}
+}
+
+func TestAllLoadThen(t *testing.T) {
+	r := newSquareResolver()
+	f := LoadThen(r, 2, func(v int) int { return -v })
+	if err := r.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := slices.Collect(f.resolver.All()); !slices.Equal(got, []int{-4}) {
+		t.Errorf("All() = %v, want [-4]", got)
+	}
+}
+
+func TestAllTree(t *testing.T) {
+	type node struct{ id, parent int }
+	rows := []node{{1, 0}, {2, 1}, {3, 1}}
+	r := NewTreeResolver("node", func(_ context.Context, parents []int) ([]node, error) {
+		var children []node
+		for _, row := range rows {
+			if slices.Contains(parents, row.parent) {
+				children = append(children, row)
+			}
+		}
+		return children, nil
+	}, func(n node) int { return n.id }, func(n node) int { return n.parent })
+	r.Future(0)
+	if err := r.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for nodes := range r.All() {
+		n += len(nodes)
+	}
+	if n != len(rows) {
+		t.Errorf("yielded %d nodes, want %d", n, len(rows))
+	}
+}
@@ -0,0 +1,59 @@
+package lazyresolve
+
+import (
+	"context"
+	"fmt"
+)
+
+// ArgKey is the key of a value loaded with an extra argument.
+type ArgKey[Key, Arg comparable] struct {
+	Key Key
+	Arg Arg
+}
+
+// ArgResolver is a resolver of loads parameterized by an argument besides the key, e.g. whether to
+// include soft-deleted rows. Values are cached per key and argument.
+type ArgResolver[T any, Key, Arg comparable] struct {
+	Resolver[T, ArgKey[Key, Arg]]
+}
+
+// NewArgResolver returns an ArgResolver calling resolve once per distinct argument in a batch.
+// The values returned for an argument are aligned with the keys passed for it.
+func NewArgResolver[T any, Key, Arg comparable](
+	name string,
+	resolve func(ctx context.Context, arg Arg, keys []Key) ([]T, error),
+	opts ...ResolverOption,
+) *ArgResolver[T, Key, Arg] {
+	return &ArgResolver[T, Key, Arg]{
+		Resolver: NewResolver(name, func(ctx context.Context, keys []ArgKey[Key, Arg]) ([]T, error) {
+			var args []Arg
+			keysByArg := map[Arg][]Key{}
+			indexesByArg := map[Arg][]int{}
+			for i, key := range keys {
+				if _, ok := keysByArg[key.Arg]; !ok {
+					args = append(args, key.Arg)
+				}
+				keysByArg[key.Arg] = append(keysByArg[key.Arg], key.Key)
+				indexesByArg[key.Arg] = append(indexesByArg[key.Arg], i)
+			}
+			vs := make([]T, len(keys))
+			for _, arg := range args {
+				avs, err := resolve(ctx, arg, keysByArg[arg])
+				if err != nil {
+					return nil, fmt.Errorf("arg=%v: %w", arg, err)
+				}
+				for i, v := range avs {
+					if i >= len(indexesByArg[arg]) {
+						break
+					}
+					vs[indexesByArg[arg][i]] = v
+				}
+			}
+			return vs, nil
+		}, opts...),
+	}
+}
+
+func (r *ArgResolver[T, Key, Arg]) Future(key Key, arg Arg) *Future[T, ArgKey[Key, Arg]] {
+	return r.Resolver.Future(ArgKey[Key, Arg]{Key: key, Arg: arg})
+}
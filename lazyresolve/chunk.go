@@ -0,0 +1,78 @@
+package lazyresolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+// WithParallelChunks splits each batch into chunks of up to size distinct keys and resolves up to
+// concurrency of them at once, e.g. to bound the IN clause of a query. The values returned for a
+// chunk are aligned with its keys and matched to the futures by key, whatever order the chunks
+// finish in; the future of a key missing from its chunk fails with a KeyNotFoundError, as without
+// chunks. A chunk failing with ErrPartial leaves its missing keys to the next pass.
+func WithParallelChunks(size, concurrency int) ResolverOption {
+	return func(o *resolverOptions) {
+		o.chunkSize = size
+		o.chunkConcurrency = concurrency
+	}
+}
+
+// parallelChunks returns a loader resolving the chunks of a batch with resolve, failing the keys
+// missing from their chunk.
+func parallelChunks[T any, Key comparable](name string, resolve func(context.Context, []Key) ([]T, error), size, concurrency int) func(context.Context, []Key) ([]Result[T], error) {
+	return func(ctx context.Context, keys []Key) ([]Result[T], error) {
+		chunks := lo.Chunk(lo.Uniq(keys), size)
+		if len(chunks) == 1 {
+			// the values of keys missing at the end are reported as without chunks
+			vs, err := resolve(ctx, keys)
+			return lo.Map(vs, func(v T, _ int) Result[T] {
+				return Result[T]{Value: v}
+			}), err
+		}
+
+		var mu sync.Mutex
+		results := make(map[Key]Result[T], len(keys))
+		errs := make([]error, len(chunks))
+		sem := make(chan struct{}, max(concurrency, 1))
+		var wg sync.WaitGroup
+		for i, chunk := range chunks {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				vs, err := resolve(ctx, chunk)
+				partial := errors.Is(err, ErrPartial)
+				if err != nil && !partial {
+					errs[i] = fmt.Errorf("chunk=%d: %w", i, err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				for j, key := range chunk {
+					switch {
+					case j < len(vs):
+						results[key] = Result[T]{Value: vs[j]}
+					case partial:
+						results[key] = Result[T]{Err: ErrPartial}
+					default:
+						results[key] = Result[T]{Err: &KeyNotFoundError{Resolver: name, Key: key}}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return lo.Map(keys, func(key Key, _ int) Result[T] {
+			return results[key]
+		}), nil
+	}
+}
@@ -0,0 +1,54 @@
+package lazyresolve
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithParallelChunks(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int64
+	r := NewResolver("double", func(_ context.Context, keys []int) ([]int, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for m := maxInFlight.Load(); n > m && !maxInFlight.CompareAndSwap(m, n); m = maxInFlight.Load() {
+		}
+		if len(keys) > 500 {
+			t.Errorf("chunk of %d keys", len(keys))
+		}
+		values := make([]int, len(keys))
+		for i, k := range keys {
+			values[i] = k * 2
+		}
+		// the last key of the chunk of key 0 is not found
+		if slices.Contains(keys, 0) {
+			values = values[:len(values)-1]
+		}
+		return values, nil
+	}, WithParallelChunks(500, 4))
+	futures := make([]*Future[int, int], 5000)
+	for k := range futures {
+		futures[k] = r.Future(k)
+	}
+	if err := ResolveAll(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	for k, f := range futures {
+		v, err := f.Get()
+		if k == 499 {
+			var notFound *KeyNotFoundError
+			if !errors.As(err, &notFound) || notFound.Key != 499 {
+				t.Errorf("key 499: got %d, %v, want a KeyNotFoundError", v, err)
+			}
+			continue
+		}
+		if err != nil || v != k*2 {
+			t.Errorf("key %d: got %d, %v", k, v, err)
+		}
+	}
+	if n := maxInFlight.Load(); n > 4 {
+		t.Errorf("%d chunks in flight, want at most 4", n)
+	}
+}
@@ -0,0 +1,78 @@
+package lazyresolve
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Coalescing wraps a resolve function so that keys requested within window, even from
+// separate requests, are loaded by a single call. The returned function is meant to be
+// shared across requests and passed to NewResolver.
+func Coalescing[T any, Key comparable](resolve func(context.Context, []Key) ([]T, error), window time.Duration) func(context.Context, []Key) ([]T, error) {
+	c := &coalescer[T, Key]{resolve: resolve, window: window}
+	return c.load
+}
+
+type coalescer[T any, Key comparable] struct {
+	resolve func(context.Context, []Key) ([]T, error)
+	window  time.Duration
+	mu      sync.Mutex
+	batch   *coalescedBatch[T, Key]
+}
+
+type coalescedBatch[T any, Key comparable] struct {
+	keys  []Key
+	index map[Key]int
+	done  chan struct{}
+	vs    []T
+	err   error
+}
+
+func (c *coalescer[T, Key]) load(ctx context.Context, keys []Key) ([]T, error) {
+	c.mu.Lock()
+	b := c.batch
+	if b == nil {
+		b = &coalescedBatch[T, Key]{index: map[Key]int{}, done: make(chan struct{})}
+		c.batch = b
+		bctx := context.WithoutCancel(ctx)
+		time.AfterFunc(c.window, func() {
+			c.flush(bctx, b)
+		})
+	}
+	for _, key := range keys {
+		if _, ok := b.index[key]; !ok {
+			b.index[key] = len(b.keys)
+			b.keys = append(b.keys, key)
+		}
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-b.done:
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	vs := make([]T, 0, len(keys))
+	for _, key := range keys {
+		i := b.index[key]
+		if i >= len(b.vs) {
+			break
+		}
+		vs = append(vs, b.vs[i])
+	}
+	return vs, nil
+}
+
+func (c *coalescer[T, Key]) flush(ctx context.Context, b *coalescedBatch[T, Key]) {
+	c.mu.Lock()
+	if c.batch == b {
+		c.batch = nil
+	}
+	c.mu.Unlock()
+	b.vs, b.err = c.resolve(ctx, b.keys)
+	close(b.done)
+}
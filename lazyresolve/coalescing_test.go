@@ -0,0 +1,41 @@
+package lazyresolve
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescing(t *testing.T) {
+	var calls atomic.Int64
+	load := Coalescing(func(_ context.Context, keys []int) ([]int, error) {
+		calls.Add(1)
+		return keys, nil
+	}, 200*time.Millisecond)
+	// resolvers of concurrent requests sharing the coalesced function
+	var wg sync.WaitGroup
+	for req := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := NewResolver("user", load)
+			f1, f2 := r.Future(req), r.Future(100)
+			if err := ResolveAll(context.Background(), r); err != nil {
+				t.Error(err)
+				return
+			}
+			if v, err := f1.Get(); err != nil || v != req {
+				t.Errorf("request %d: got %d, %v", req, v, err)
+			}
+			if v, err := f2.Get(); err != nil || v != 100 {
+				t.Errorf("request %d: got %d, %v for the shared key", req, v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("backend called %d times, want 1", n)
+	}
+}
@@ -0,0 +1,88 @@
+package lazyresolve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"iter"
+)
+
+// WithCompression keeps the resolved values whose JSON is at least threshold bytes gzipped in
+// the cache, e.g. large denormalized documents under a tight memory limit, decompressing them
+// when a future of the key is created again. Smaller values are kept as is. Values must round-trip
+// through encoding/json, and a value that fails to is kept as is too.
+func WithCompression(threshold int) ResolverOption {
+	return func(o *resolverOptions) {
+		o.compression = true
+		o.compressionThreshold = threshold
+	}
+}
+
+// compressingStore gzips the JSON of large values before storing them in store.
+type compressingStore[T any, Key comparable] struct {
+	store     valueStore[T, Key]
+	threshold int
+}
+
+func (s *compressingStore[T, Key]) get(key Key) (*resolvedValue[T], bool) {
+	v, ok := s.store.get(key)
+	if !ok {
+		return nil, false
+	}
+	return decompress(v)
+}
+
+func (s *compressingStore[T, Key]) all() iter.Seq2[Key, *resolvedValue[T]] {
+	return func(yield func(Key, *resolvedValue[T]) bool) {
+		for key, v := range s.store.all() {
+			if v, ok := decompress(v); ok && !yield(key, v) {
+				return
+			}
+		}
+	}
+}
+
+// decompress returns v with its value decoded from compressed, if it is.
+func decompress[T any](v *resolvedValue[T]) (*resolvedValue[T], bool) {
+	if v.compressed == nil {
+		return v, true
+	}
+	b, err := gunzip(v.compressed)
+	if err != nil {
+		return nil, false
+	}
+	var value T
+	if err := json.Unmarshal(b, &value); err != nil {
+		return nil, false
+	}
+	return &resolvedValue[T]{value: value, encoded: &encodedValue{}}, true
+}
+
+func (s *compressingStore[T, Key]) set(key Key, v *resolvedValue[T]) {
+	b, err := json.Marshal(v.value)
+	if err != nil || len(b) < s.threshold {
+		s.store.set(key, v)
+		return
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		s.store.set(key, v)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		s.store.set(key, v)
+		return
+	}
+	s.store.set(key, &resolvedValue[T]{compressed: buf.Bytes()})
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,59 @@
+package lazyresolve
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompressingStore(t *testing.T) {
+	small := &testProfile{ID: 1, Bio: "bio", Tags: []string{"a"}}
+	large := &testProfile{ID: 2, Bio: strings.Repeat("bio ", 64), Tags: []string{"a", "b", "c"}}
+	inner := mapStore[*testProfile, int]{}
+	s := &compressingStore[*testProfile, int]{store: inner, threshold: 100}
+	for _, tt := range []struct {
+		name           string
+		value          *testProfile
+		wantCompressed bool
+	}{
+		{name: "below threshold", value: small},
+		{name: "above threshold", value: large, wantCompressed: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s.set(tt.value.ID, &resolvedValue[*testProfile]{value: tt.value, encoded: &encodedValue{}})
+			stored := inner[tt.value.ID]
+			if compressed := stored.compressed != nil; compressed != tt.wantCompressed {
+				t.Errorf("compressed = %t, want %t", compressed, tt.wantCompressed)
+			}
+			if tt.wantCompressed && stored.value != nil {
+				t.Error("kept the value along with its compressed JSON")
+			}
+			v, ok := s.get(tt.value.ID)
+			if !ok || !reflect.DeepEqual(v.value, tt.value) {
+				t.Errorf("got %+v, %t, want %+v", v, ok, tt.value)
+			}
+		})
+	}
+}
+
+func TestWithCompression(t *testing.T) {
+	var loads int
+	r := NewResolver("profile", func(_ context.Context, keys []int) ([]*testProfile, error) {
+		loads++
+		return newProfiles(keys), nil
+	}, WithCompression(100))
+	f := r.Future(1)
+	if err := r.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := f.Get()
+	// decompressed from the cache without loading again
+	got, err := r.Future(1).Get()
+	if err != nil || !reflect.DeepEqual(got, want) || loads != 1 {
+		t.Errorf("got %+v, %v after %d loads, want %+v after 1", got, err, loads, want)
+	}
+	if got == want {
+		t.Error("got the same pointer, not one decoded from the compressed JSON")
+	}
+}
@@ -0,0 +1,61 @@
+package lazyresolve
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentUse(t *testing.T) {
+	r := newSquareResolver()
+	type node struct{ id, parent int }
+	tree := NewTreeResolver("node", func(_ context.Context, parents []int) ([]node, error) {
+		var children []node
+		for _, p := range parents {
+			if p < 100 {
+				children = append(children, node{id: p + 100, parent: p})
+			}
+		}
+		return children, nil
+	}, func(n node) int { return n.id }, func(n node) int { return n.parent })
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.Background()
+			var futures []*Future[int, int]
+			var dependents []*Future[int, int]
+			for k := range 20 {
+				f := r.Future(g*20 + k)
+				futures = append(futures, f)
+				// callbacks registered while other goroutines may be settling f
+				dependents = append(dependents, When(f, r, func(v int) (int, bool) { return v % 7, true }))
+				tree.Future(k)
+			}
+			if err := Wait(ctx, r); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := Wait(ctx, tree); err != nil {
+				t.Error(err)
+				return
+			}
+			for i, f := range futures {
+				k := g*20 + i
+				if v, err := f.Get(); err != nil || v != k*k {
+					t.Errorf("key %d: got %d, %v", k, v, err)
+				}
+				if v, err := dependents[i].Get(); err != nil || v != (k*k%7)*(k*k%7) {
+					t.Errorf("dependent of key %d: got %d, %v", k, v, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := slices.Sorted(r.All()); len(got) < 160 {
+		t.Errorf("%d values cached, want at least 160", len(got))
+	}
+}
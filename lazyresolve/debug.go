@@ -0,0 +1,33 @@
+package lazyresolve
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DebugErrorHandler returns an echo.HTTPErrorHandler responding to an UnresolvedError with the
+// resolvers left pending and their counts as JSON when debug is true, and calling next otherwise.
+// The body exposes resolver names, so debug must be false in production.
+//
+//	e.HTTPErrorHandler = lazyresolve.DebugErrorHandler(os.Getenv("DEBUG") != "", e.DefaultHTTPErrorHandler)
+func DebugErrorHandler(debug bool, next echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		var ue *UnresolvedError
+		if !debug || !errors.As(err, &ue) || c.Response().Committed {
+			next(err, c)
+			return
+		}
+		// written directly, since JSONSerializer would fail to resolve again
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c.Response().WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(c.Response()).Encode(map[string]any{
+			"error":     err.Error(),
+			"resolvers": ue.Resolvers,
+		}); err != nil {
+			c.Logger().Error(err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package lazyresolve
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestEagerMode(t *testing.T) {
+	var batches [][]int
+	var r Resolver[int, int]
+	r = NewResolver("square", func(_ context.Context, keys []int) ([]int, error) {
+		batches = append(batches, slices.Clone(keys))
+		values := make([]int, len(keys))
+		for i, k := range keys {
+			values[i] = k * k
+		}
+		return values, nil
+	}, WithEagerMode(true))
+	ctx := WithQueryCounter(context.Background())
+	if v, err := FutureContext(ctx, r, 3).Get(); err != nil || v != 9 {
+		t.Errorf("got %d, %v, want 9", v, err)
+	}
+	if n := QueryCount(ctx); n != 1 {
+		t.Errorf("QueryCount = %d, want 1", n)
+	}
+	if r.Count() != 0 {
+		t.Errorf("%d futures pending", r.Count())
+	}
+	if !slices.EqualFunc(batches, [][]int{{3}}, slices.Equal) {
+		t.Errorf("batches = %v", batches)
+	}
+}
+
+func TestEagerModeWhileResolving(t *testing.T) {
+	var r Resolver[int, int]
+	var inner *Future[int, int]
+	var nested bool
+	r = NewResolver("square", func(_ context.Context, keys []int) ([]int, error) {
+		if !nested {
+			// a call site migrated to futures inside the resolve of another
+			nested = true
+			inner = r.Future(4)
+		}
+		values := make([]int, len(keys))
+		for i, k := range keys {
+			values[i] = k * k
+		}
+		return values, nil
+	}, WithEagerMode(true))
+	if v, err := r.Future(2).Get(); err != nil || v != 4 {
+		t.Errorf("got %d, %v, want 4", v, err)
+	}
+	if v, err := inner.Get(); err != nil || v != 16 {
+		t.Errorf("future created while resolving: got %d, %v, want 16", v, err)
+	}
+}
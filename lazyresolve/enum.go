@@ -0,0 +1,23 @@
+package lazyresolve
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+)
+
+// EnumUnknown is the value NewEnumResolver resolves keys absent from its table to.
+const EnumUnknown = "unknown"
+
+// NewEnumResolver returns a resolver of labels of static lookups like status id to status name,
+// resolving from table without IO. Keys absent from table resolve to EnumUnknown.
+func NewEnumResolver[Key comparable](name string, table map[Key]string, opts ...ResolverOption) Resolver[string, Key] {
+	return NewResolver(name, func(_ context.Context, keys []Key) ([]string, error) {
+		return lo.Map(keys, func(key Key, _ int) string {
+			if label, ok := table[key]; ok {
+				return label
+			}
+			return EnumUnknown
+		}), nil
+	}, opts...)
+}
@@ -0,0 +1,39 @@
+package lazyresolve
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type testRow struct {
+	ID        int        `json:"id"`
+	DeletedAt *time.Time `json:"-"`
+}
+
+func TestWithFilter(t *testing.T) {
+	deleted := time.Now()
+	r := NewResolver("row", WithFilter(func(_ context.Context, keys []int) ([]*testRow, error) {
+		rows := make([]*testRow, len(keys))
+		for i, k := range keys {
+			rows[i] = &testRow{ID: k}
+			if k%2 == 0 {
+				rows[i].DeletedAt = &deleted
+			}
+		}
+		return rows, nil
+	}, func(row *testRow) bool {
+		return row.DeletedAt == nil
+	}))
+	kept, dropped := r.Future(1), r.Future(2)
+	if err := ResolveAll(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if row, err := kept.Get(); err != nil || row == nil || row.ID != 1 {
+		t.Errorf("kept row: got %v, %v", row, err)
+	}
+	if b, err := json.Marshal(dropped); err != nil || string(b) != "null" {
+		t.Errorf("soft-deleted row: got %s, %v, want null", b, err)
+	}
+}
@@ -0,0 +1,96 @@
+package lazyresolve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+var ErrDependencyCycle = fmt.Errorf("dependency cycle")
+
+// DependencyGraph resolves resolvers in dependency order so that a well-structured graph
+// converges in a single sweep instead of relying on the passes of ResolveAll.
+type DependencyGraph struct {
+	resolvers []ResolverSubset
+	deps      map[ResolverSubset][]ResolverSubset
+}
+
+func NewDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{deps: map[ResolverSubset][]ResolverSubset{}}
+}
+
+// AddResolver adds r, whose futures are created as the futures of the resolvers in dependsOn
+// resolve, e.g. users depending on posts for post authors. Hence dependsOn are resolved before r.
+func (g *DependencyGraph) AddResolver(r ResolverSubset, dependsOn ...ResolverSubset) {
+	for _, d := range append([]ResolverSubset{r}, dependsOn...) {
+		if _, ok := g.deps[d]; !ok {
+			g.resolvers = append(g.resolvers, d)
+			g.deps[d] = nil
+		}
+	}
+	g.deps[r] = append(g.deps[r], dependsOn...)
+}
+
+// Resolve resolves each resolver once in dependency order. If futures remain afterwards,
+// e.g. because of an undeclared dependency, it falls back to ResolveAll.
+func (g *DependencyGraph) Resolve(ctx context.Context) error {
+	order, err := g.order()
+	if err != nil {
+		return err
+	}
+	for _, r := range order {
+		if err := r.Resolve(ctx); err != nil {
+			return err
+		}
+	}
+	remain := lo.SumBy(order, func(r ResolverSubset) int {
+		return r.Count()
+	})
+	if remain == 0 {
+		return nil
+	}
+	return ResolveAll(ctx, order...)
+}
+
+// order sorts the resolvers topologically so that each one follows its dependencies.
+func (g *DependencyGraph) order() ([]ResolverSubset, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[ResolverSubset]int{}
+	var stack []ResolverSubset
+	var post []ResolverSubset
+	var visit func(r ResolverSubset) error
+	visit = func(r ResolverSubset) error {
+		switch state[r] {
+		case visiting:
+			names := lo.Map(append(stack, r), func(r ResolverSubset, _ int) string {
+				return r.Name()
+			})
+			return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(names, " -> "))
+		case visited:
+			return nil
+		}
+		state[r] = visiting
+		stack = append(stack, r)
+		for _, d := range g.deps[r] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[r] = visited
+		post = append(post, r)
+		return nil
+	}
+	for _, r := range g.resolvers {
+		if err := visit(r); err != nil {
+			return nil, err
+		}
+	}
+	return post, nil
+}
@@ -0,0 +1,60 @@
+package lazyresolve
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	var calls []string
+	// each resolver maps a key to key + 1, recording its batches
+	newResolver := func(name string) Resolver[int, int] {
+		return NewResolver(name, func(_ context.Context, keys []int) ([]int, error) {
+			calls = append(calls, name)
+			values := make([]int, len(keys))
+			for i, k := range keys {
+				values[i] = k + 1
+			}
+			return values, nil
+		})
+	}
+	posts, users, teams := newResolver("post"), newResolver("user"), newResolver("team")
+	var team *Future[int, int]
+	for _, k := range []int{1, 2} {
+		posts.Future(k * 10).OnResolved(func(author int) {
+			users.Future(author).OnResolved(func(id int) {
+				team = teams.Future(id)
+			})
+		})
+	}
+	g := NewDependencyGraph()
+	// declared out of order, so that the order comes from the dependencies
+	g.AddResolver(teams, users)
+	g.AddResolver(users, posts)
+	if err := g.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"post", "user", "team"}; !slices.Equal(calls, want) {
+		t.Errorf("resolved in order %v, want %v", calls, want)
+	}
+	if v, err := team.Get(); err != nil || v != 23 {
+		t.Errorf("got %v, %v, want 23", v, err)
+	}
+}
+
+func TestDependencyGraphCycle(t *testing.T) {
+	a, b, c := newSquareResolver(), WithName(newSquareResolver(), "b"), WithName(newSquareResolver(), "c")
+	g := NewDependencyGraph()
+	g.AddResolver(a, b)
+	g.AddResolver(b, c)
+	g.AddResolver(c, a)
+	err := g.Resolve(context.Background())
+	if !errors.Is(err, ErrDependencyCycle) {
+		t.Fatalf("got %v, want ErrDependencyCycle", err)
+	}
+	if want := "dependency cycle: square -> b -> c -> square"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
@@ -0,0 +1,20 @@
+package lazyresolve
+
+import "context"
+
+// Result is the value or the error a dataloader-style loader returns for a key.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// FromLoader adapts load, a batch function of a dataloader library returning a Result per key in
+// the order of keys, into a resolver, e.g. to move loaders into ResolveAll one at a time. A future
+// whose key has an error fails with it, see Recover, while the others resolve; the error of load
+// itself fails the batch like that of a resolve function. Failed keys are not cached.
+// WithParallelChunks has no effect on it.
+func FromLoader[T any, Key comparable](name string, load func(ctx context.Context, keys []Key) ([]Result[T], error), opts ...ResolverOption) Resolver[T, Key] {
+	r := newResolver[T, Key](name, nil, opts...)
+	r._load = load
+	return r
+}
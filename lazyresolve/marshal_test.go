@@ -0,0 +1,172 @@
+package lazyresolve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testProfile struct {
+	ID   int      `json:"id"`
+	Bio  string   `json:"bio"`
+	Tags []string `json:"tags"`
+}
+
+func newProfiles(keys []int) []*testProfile {
+	profiles := make([]*testProfile, len(keys))
+	for i, k := range keys {
+		profiles[i] = &testProfile{ID: k, Bio: strings.Repeat("bio ", 64), Tags: []string{"a", "b", "c"}}
+	}
+	return profiles
+}
+
+func newProfileResolver() Resolver[*testProfile, int] {
+	return NewResolver("profile", func(_ context.Context, keys []int) ([]*testProfile, error) {
+		return newProfiles(keys), nil
+	})
+}
+
+func TestMarshalMemoizedWithinPass(t *testing.T) {
+	r := newProfileResolver()
+	f := r.Future(1)
+	if err := r.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	p, _ := f.Get()
+	marshal := func() string {
+		var b []byte
+		if err := marshalInPass(func() (err error) {
+			b, err = json.Marshal(r.Future(1))
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	marshal()
+	p.Bio = "mutated"
+	if got := marshal(); !strings.Contains(got, `"bio":"mutated"`) {
+		t.Errorf("stale JSON in the next pass: %s", got)
+	}
+	p.Bio = "outside"
+	if b, err := json.Marshal(f); err != nil || !strings.Contains(string(b), `"bio":"outside"`) {
+		t.Errorf("stale JSON outside a pass: %s, %v", b, err)
+	}
+}
+
+func BenchmarkMarshalList(b *testing.B) {
+	// 1000 items referring to 10 profiles, as in a list endpoint
+	type item struct {
+		ID      int                        `json:"id"`
+		Profile *Future[*testProfile, int] `json:"profile"`
+	}
+	r := newProfileResolver()
+	items := make([]item, 1000)
+	for i := range items {
+		items[i] = item{ID: i, Profile: r.Future(i % 10)}
+	}
+	if err := r.Resolve(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("pass", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			if err := marshalInPass(func() error {
+				_, err := json.Marshal(items)
+				return err
+			}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("no pass", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			if _, err := json.Marshal(items); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestMarshalOptionalFuture(t *testing.T) {
+	type dto struct {
+		Square *Future[int, int] `json:"square"`
+	}
+	for _, tt := range []struct {
+		name string
+		// future returns the field of the DTO, marshaled after resolving r
+		future  func(r Resolver[int, int]) *Future[int, int]
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "nil",
+			future: func(Resolver[int, int]) *Future[int, int] { return nil },
+			want:   `{"square":null}`,
+		},
+		{
+			name:   "optional nil",
+			future: func(Resolver[int, int]) *Future[int, int] { return OptionalFuture[int, int](nil) },
+			want:   `{"square":null}`,
+		},
+		{
+			name:   "resolved",
+			future: func(r Resolver[int, int]) *Future[int, int] { return r.Future(3) },
+			want:   `{"square":9}`,
+		},
+		{
+			name:   "optional resolved",
+			future: func(r Resolver[int, int]) *Future[int, int] { return OptionalFuture(r.Future(3)) },
+			want:   `{"square":9}`,
+		},
+		{
+			name:   "optional not found",
+			future: func(r Resolver[int, int]) *Future[int, int] { return OptionalFuture(r.Future(101)) },
+			want:   `{"square":null}`,
+		},
+		{
+			name:    "not found",
+			future:  func(r Resolver[int, int]) *Future[int, int] { return r.Future(101) },
+			wantErr: ErrKeyNotFound,
+		},
+		{
+			name: "optional unresolved",
+			future: func(Resolver[int, int]) *Future[int, int] {
+				// of a resolver that is not resolved
+				return OptionalFuture(newSquareResolver().Future(1))
+			},
+			wantErr: ErrNotResolved,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// keys above 100 are not found
+			r := NewResolver("square", func(_ context.Context, keys []int) ([]int, error) {
+				var values []int
+				for _, k := range keys {
+					if k > 100 {
+						break
+					}
+					values = append(values, k*k)
+				}
+				return values, nil
+			})
+			v := dto{Square: tt.future(r)}
+			if err := r.Resolve(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(v)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %s, %v, want %v", b, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(b) != tt.want {
+				t.Errorf("got %s, %v, want %s", b, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package lazyresolve
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type testBundle struct {
+	posts Resolver[int, int]
+	users Resolver[int, int]
+}
+
+func (b *testBundle) ResolveAll(ctx context.Context) error {
+	return ResolveAll(ctx, b.posts, b.users)
+}
+
+type testPostDTO struct {
+	ID     int               `json:"id"`
+	Author *Future[int, int] `json:"author"`
+}
+
+func TestResolversMiddlewareQueryCount(t *testing.T) {
+	e := echo.New()
+	// post k is written by user 10 * k, whose value is its ID
+	err := Install(e, func(ctx context.Context) (context.Context, error) {
+		return WithResolvers(ctx, &testBundle{
+			posts: NewResolver("post", func(_ context.Context, keys []int) ([]int, error) {
+				values := make([]int, len(keys))
+				for i, k := range keys {
+					values[i] = 10 * k
+				}
+				return values, nil
+			}),
+			users: NewResolver("user", func(_ context.Context, keys []int) ([]int, error) {
+				return keys, nil
+			}),
+		}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counts []int
+	e.GET("/posts", func(c echo.Context) error {
+		rs, err := GetResolvers[*testBundle](c.Request().Context())
+		if err != nil {
+			return err
+		}
+		dtos := make([]*testPostDTO, 3)
+		for i := range dtos {
+			dto := &testPostDTO{ID: i + 1}
+			rs.posts.Future(i + 1).OnResolved(func(author int) {
+				dto.Author = rs.users.Future(author)
+			})
+			dtos[i] = dto
+		}
+		err = c.JSON(http.StatusOK, dtos)
+		counts = append(counts, QueryCount(c.Request().Context()))
+		return err
+	})
+	for range 2 {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/posts", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		if want := `[{"id":1,"author":10},{"id":2,"author":20},{"id":3,"author":30}]` + "\n"; rec.Body.String() != want {
+			t.Errorf("got %s, want %s", rec.Body, want)
+		}
+	}
+	// one batch per resolver, counted per request
+	if len(counts) != 2 || counts[0] != 2 || counts[1] != 2 {
+		t.Errorf("got query counts %v, want [2 2]", counts)
+	}
+}
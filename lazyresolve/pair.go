@@ -0,0 +1,24 @@
+package lazyresolve
+
+import "context"
+
+// Pair is a value resolved together with a related one, e.g. a line item with its product.
+type Pair[A, B any] struct {
+	A A
+	B B
+}
+
+// NewPairResolver returns a resolver of pairs loaded by a single joined query, instead of a batch
+// per side. The rows returned by resolve are aligned with the keys like those of NewResolver,
+// and toPair splits each of them into its two sides.
+func NewPairResolver[Row, A, B any, Key comparable](
+	name string,
+	resolve func(context.Context, []Key) ([]Row, error),
+	toPair func(Row) (A, B),
+	opts ...ResolverOption,
+) Resolver[Pair[A, B], Key] {
+	return NewResolver(name, WithMapper(resolve, func(row Row) Pair[A, B] {
+		a, b := toPair(row)
+		return Pair[A, B]{A: a, B: b}
+	}), opts...)
+}
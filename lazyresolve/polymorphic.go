@@ -0,0 +1,51 @@
+package lazyresolve
+
+import (
+	"context"
+	"fmt"
+)
+
+// PolymorphicKey identifies a value of a polymorphic relation, e.g. {Type: "post", ID: 1}.
+type PolymorphicKey struct {
+	Type string
+	ID   int
+}
+
+// NewPolymorphicResolver returns a resolver of an interface type T whose keys are routed to
+// the resolve function registered for their Type, one call per type in a batch, in the order the
+// first key of each type was registered.
+// Futures marshal to the JSON of the concrete value. A key missing from the result of its
+// resolve function resolves to the zero value of T, which marshals to null.
+func NewPolymorphicResolver[T any](name string, resolvers map[string]func(context.Context, []int) ([]T, error), opts ...ResolverOption) Resolver[T, PolymorphicKey] {
+	return NewResolver(name, func(ctx context.Context, keys []PolymorphicKey) ([]T, error) {
+		var types []string
+		idsByType := map[string][]int{}
+		indexesByType := map[string][]int{}
+		for i, key := range keys {
+			if _, ok := idsByType[key.Type]; !ok {
+				types = append(types, key.Type)
+			}
+			idsByType[key.Type] = append(idsByType[key.Type], key.ID)
+			indexesByType[key.Type] = append(indexesByType[key.Type], i)
+		}
+		vs := make([]T, len(keys))
+		for _, typ := range types {
+			ids := idsByType[typ]
+			resolve, ok := resolvers[typ]
+			if !ok {
+				return nil, fmt.Errorf("unknown type: resolver=%s, type=%s", name, typ)
+			}
+			tvs, err := resolve(ctx, ids)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve type=%s: %w", typ, err)
+			}
+			for i, v := range tvs {
+				if i >= len(ids) {
+					break
+				}
+				vs[indexesByType[typ][i]] = v
+			}
+		}
+		return vs, nil
+	}, opts...)
+}
@@ -0,0 +1,75 @@
+package lazyresolve
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+type feedItem interface {
+	isFeedItem()
+}
+
+type feedPost struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+func (feedPost) isFeedItem() {}
+
+type feedComment struct {
+	ID   int    `json:"id"`
+	Body string `json:"body"`
+}
+
+func (feedComment) isFeedItem() {}
+
+func TestPolymorphicResolver(t *testing.T) {
+	for range 20 {
+		var calls []string
+		r := NewPolymorphicResolver("feed", map[string]func(context.Context, []int) ([]feedItem, error){
+			"post": func(_ context.Context, ids []int) ([]feedItem, error) {
+				calls = append(calls, "post")
+				items := make([]feedItem, len(ids))
+				for i, id := range ids {
+					items[i] = feedPost{ID: id, Title: "title"}
+				}
+				return items, nil
+			},
+			"comment": func(_ context.Context, ids []int) ([]feedItem, error) {
+				calls = append(calls, "comment")
+				items := make([]feedItem, len(ids))
+				for i, id := range ids {
+					items[i] = feedComment{ID: id, Body: "body"}
+				}
+				return items, nil
+			},
+			"like": func(_ context.Context, ids []int) ([]feedItem, error) {
+				calls = append(calls, "like")
+				// no like is found
+				return nil, nil
+			},
+		})
+		futures := FuturesFor(r, []PolymorphicKey{
+			{Type: "comment", ID: 1},
+			{Type: "post", ID: 1},
+			{Type: "like", ID: 1},
+			{Type: "comment", ID: 2},
+		})
+		if err := ResolveAll(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"comment", "post", "like"}; !slices.Equal(calls, want) {
+			t.Fatalf("resolved types in order %v, want %v", calls, want)
+		}
+		b, err := json.Marshal(futures)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `[{"id":1,"body":"body"},{"id":1,"title":"title"},null,{"id":2,"body":"body"}]`
+		if string(b) != want {
+			t.Fatalf("got %s, want %s", b, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package lazyresolve
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Pool bounds the Resolve calls in flight across the resolvers of every ResolveAllWithPool it is
+// passed to, e.g. to size them to the connection pool of the database. Share one across requests.
+type Pool struct {
+	sem chan struct{}
+}
+
+func NewPool(size int) *Pool {
+	return &Pool{sem: make(chan struct{}, max(size, 1))}
+}
+
+// ResolveAllWithPool is ResolveAll resolving the resolvers with pending futures concurrently in
+// each pass, up to the size of pool at once together with other calls sharing it. Futures created
+// by callbacks for a resolver resolved in the same pass are left to the next one, so chains of
+// dependent futures take more passes than with ResolveAll. The futures of a pass are settled and
+// their callbacks called once all of its resolvers have returned, one resolver after another, so
+// callbacks need not be safe for concurrent use.
+func ResolveAllWithPool(ctx context.Context, pool *Pool, resolvers ...ResolverSubset) error {
+	return resolveAll(ctx, resolvers, pool, nil)
+}
+
+func (p *Pool) resolvePass(ctx context.Context, resolvers []ResolverSubset) error {
+	errs := make([]error, len(resolvers))
+	// settling futures is deferred until the pass is done, as callbacks may touch futures and
+	// resolvers of each other
+	settles := make([][]func(), len(resolvers))
+	var wg sync.WaitGroup
+	for i, r := range resolvers {
+		if r.Count() == 0 {
+			continue
+		}
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-p.sem
+				wg.Done()
+			}()
+			errs[i] = r.Resolve(context.WithValue(ctx, deferredSettleKey, &settles[i]))
+		}()
+	}
+	wg.Wait()
+	for _, settle := range settles {
+		for _, fn := range settle {
+			fn()
+		}
+	}
+	return errors.Join(errs...)
+}
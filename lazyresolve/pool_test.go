@@ -0,0 +1,57 @@
+package lazyresolve
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+func TestResolveAllWithPoolCallbacks(t *testing.T) {
+	const poolSize = 2
+	var inFlight, maxInFlight atomic.Int64
+	newResolver := func(name string) Resolver[int, int] {
+		return NewResolver(name, func(_ context.Context, keys []int) ([]int, error) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			// long enough for the other resolvers of the pass to start if the pool let them
+			time.Sleep(time.Millisecond)
+			return keys, nil
+		})
+	}
+	resolvers := []Resolver[int, int]{newResolver("a"), newResolver("b"), newResolver("c"), newResolver("d")}
+	a := resolvers[0]
+	// callbacks of futures of all resolvers share state
+	var settled []int
+	var chained []*Future[int, int]
+	for k := range 100 {
+		for _, r := range resolvers {
+			f := r.Future(k)
+			f.OnResolved(func(v int) { settled = append(settled, v) })
+			chained = append(chained, When(f, a, func(v int) (int, bool) { return v + 100, true }))
+		}
+	}
+	subsets := lo.Map(resolvers, func(r Resolver[int, int], _ int) ResolverSubset { return r })
+	if err := ResolveAllWithPool(context.Background(), NewPool(poolSize), subsets...); err != nil {
+		t.Fatal(err)
+	}
+	if len(settled) != 400 {
+		t.Errorf("%d callbacks called, want 400", len(settled))
+	}
+	for i, f := range chained {
+		if v, err := f.Get(); err != nil || v != i/len(resolvers)+100 {
+			t.Errorf("chained future %d: got %d, %v", i, v, err)
+		}
+	}
+	if n := maxInFlight.Load(); n > poolSize {
+		t.Errorf("%d resolve calls in flight, want at most %d", n, poolSize)
+	}
+}
@@ -0,0 +1,46 @@
+package lazyresolve
+
+import (
+	"fmt"
+	"slices"
+)
+
+// PrimeFrom caches rows a mutation returned in full, e.g. by INSERT ... RETURNING, as the values of
+// r at their keys, so that futures of r for them are resolved on creation without a round trip.
+// Pending futures for the keys are resolved too and leave the next batch. The rows are cached as
+// given, without the WithFilter of the resolve function.
+// It returns an error leaving r untouched if r was not returned by NewResolver or a constructor
+// returning it as is, e.g. by NewTreeResolver, whose values cannot be primed from rows.
+func PrimeFrom[T any, Key comparable](r Resolver[T, Key], rows []T, keyOf func(T) Key) error {
+	impl, ok := r.(*resolverImpl[T, Key])
+	if !ok {
+		return fmt.Errorf("resolver cannot be primed: resolver=%s, type=%T", r.Name(), r)
+	}
+	impl.prime(rows, keyOf)
+	return nil
+}
+
+func (r *resolverImpl[T, Key]) prime(rows []T, keyOf func(T) Key) {
+	r.mu.Lock()
+	primed := make(map[Key]*resolvedValue[T], len(rows))
+	for _, row := range rows {
+		key := keyOf(row)
+		v := &resolvedValue[T]{value: row, encoded: &encodedValue{}}
+		primed[key] = v
+		r.store.set(key, v)
+	}
+	var settled []*Future[T, Key]
+	r.futures = slices.DeleteFunc(r.futures, func(f *Future[T, Key]) bool {
+		if _, ok := primed[f.key]; ok {
+			settled = append(settled, f)
+			return true
+		}
+		return false
+	})
+	r.mu.Unlock()
+	// called back without the lock, as callbacks may create futures
+	for _, f := range settled {
+		v := primed[f.key]
+		f.resolvedCallback(v.value, v.encoded)
+	}
+}
@@ -0,0 +1,42 @@
+package lazyresolve
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPrimeFrom(t *testing.T) {
+	var calls int
+	r := NewResolver("user", func(_ context.Context, keys []int) ([]testUser, error) {
+		calls++
+		users := make([]testUser, len(keys))
+		for i, k := range keys {
+			users[i] = testUser{ID: k, Name: "loaded"}
+		}
+		return users, nil
+	})
+	pending := r.Future(1)
+	inserted := []testUser{{ID: 1, Name: "alice"}, {ID: 2, Name: "bob"}}
+	if err := PrimeFrom(r, inserted, func(u testUser) int { return u.ID }); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := pending.Get(); err != nil || u.Name != "alice" {
+		t.Errorf("pending future: got %v, %v", u, err)
+	}
+	if u, err := r.Future(2).Get(); err != nil || u.Name != "bob" {
+		t.Errorf("future after priming: got %v, %v", u, err)
+	}
+	if err := r.Resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("resolve called %d times for primed keys", calls)
+	}
+}
+
+func TestPrimeFromWrapped(t *testing.T) {
+	r := LoadThen(newSquareResolver(), 1, func(v int) int { return v }).resolver
+	if err := PrimeFrom(r, []int{1}, func(v int) int { return v }); err == nil {
+		t.Error("priming a LoadThen resolver succeeded")
+	}
+}
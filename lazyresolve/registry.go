@@ -0,0 +1,61 @@
+package lazyresolve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+type registry struct {
+	mu        sync.Mutex
+	resolvers map[string]ResolverSubset
+	names     []string
+}
+
+// WithRegistry returns a context holding a registry of resolvers shared within it, see
+// GetOrRegister. ResolversMiddleware installs one for each request.
+func WithRegistry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, registryKey, &registry{resolvers: map[string]ResolverSubset{}})
+}
+
+// GetOrRegister returns the resolver registered as name in the registry of ctx, registering the
+// one construct returns the first time, so that call sites loading the same entities independently
+// share a resolver and its batches within a request. JSONSerializer resolves registered resolvers
+// along with the bundle of WithResolvers; otherwise pass RegisteredResolvers to ResolveAll.
+// Without WithRegistry, it returns a new resolver on each call.
+// It panics if the resolver registered as name has other type parameters.
+func GetOrRegister[T any, Key comparable](ctx context.Context, name string, construct func() Resolver[T, Key]) Resolver[T, Key] {
+	reg, ok := ctx.Value(registryKey).(*registry)
+	if !ok {
+		return construct()
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if r, ok := reg.resolvers[name]; ok {
+		typed, ok := r.(Resolver[T, Key])
+		if !ok {
+			panic(fmt.Sprintf("lazyresolve: resolver type %T does not match the type parameters of GetOrRegister: resolver=%s", r, name))
+		}
+		return typed
+	}
+	r := construct()
+	reg.resolvers[name] = r
+	reg.names = append(reg.names, name)
+	return r
+}
+
+// RegisteredResolvers returns the resolvers registered in the registry of ctx by GetOrRegister,
+// in the order of registration.
+func RegisteredResolvers(ctx context.Context) []ResolverSubset {
+	reg, ok := ctx.Value(registryKey).(*registry)
+	if !ok {
+		return nil
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return lo.Map(reg.names, func(name string, _ int) ResolverSubset {
+		return reg.resolvers[name]
+	})
+}
@@ -0,0 +1,53 @@
+package lazyresolve
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestGetOrRegister(t *testing.T) {
+	var constructed int
+	var batches [][]int
+	user := func(ctx context.Context, id int) *Future[int, int] {
+		return GetOrRegister(ctx, "user", func() Resolver[int, int] {
+			constructed++
+			return NewResolver("user", func(_ context.Context, keys []int) ([]int, error) {
+				batches = append(batches, slices.Clone(keys))
+				return keys, nil
+			})
+		}).Future(id)
+	}
+	ctx := WithQueryCounter(WithRegistry(context.Background()))
+	// two call sites loading users independently
+	author := user(ctx, 1)
+	commenter := user(ctx, 2)
+	if err := ResolveAll(ctx, RegisteredResolvers(ctx)...); err != nil {
+		t.Fatal(err)
+	}
+	if constructed != 1 {
+		t.Errorf("constructed %d resolvers, want 1", constructed)
+	}
+	if want := [][]int{{1, 2}}; !slices.EqualFunc(batches, want, slices.Equal) {
+		t.Errorf("got batches %v, want %v", batches, want)
+	}
+	if n := QueryCount(ctx); n != 1 {
+		t.Errorf("QueryCount = %d, want 1", n)
+	}
+	for _, f := range []*Future[int, int]{author, commenter} {
+		if _, err := f.Get(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetOrRegisterTypeMismatch(t *testing.T) {
+	ctx := WithRegistry(context.Background())
+	GetOrRegister(ctx, "square", newSquareResolver)
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a resolver of other type parameters")
+		}
+	}()
+	GetOrRegister(ctx, "square", newProfileResolver)
+}
@@ -5,18 +5,36 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"iter"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Deprecated: ResolversKey is no longer used as the context key; use WithResolvers and GetResolvers.
 var ResolversKey = "isutools.resolvers"
 
+type ctxKey int
+
+const (
+	resolversKey ctxKey = iota
+	queryCounterKey
+	registryKey
+	deferredSettleKey
+	resolverNameKey
+)
+
 func ResolversMiddleware(withResolvers func(context.Context) (context.Context, error)) func(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			ctx := c.Request().Context()
+			ctx := WithRegistry(WithQueryCounter(c.Request().Context()))
 			rctx, err := withResolvers(ctx)
 			if err != nil {
 				return fmt.Errorf("withResolvers: %w", err)
@@ -28,6 +46,40 @@ func ResolversMiddleware(withResolvers func(context.Context) (context.Context, e
 	}
 }
 
+var defaultResolverFactory func(context.Context) (any, error)
+
+// SetDefaultResolverFactory registers the factory of the resolver bundle of each request used by
+// DefaultResolversMiddleware. Call it at init, before serving requests.
+func SetDefaultResolverFactory(factory func(context.Context) (any, error)) {
+	defaultResolverFactory = factory
+}
+
+// DefaultResolversMiddleware is ResolversMiddleware storing the bundle the factory registered by
+// SetDefaultResolverFactory returns for each request with WithResolvers.
+func DefaultResolversMiddleware() func(next echo.HandlerFunc) echo.HandlerFunc {
+	return ResolversMiddleware(func(ctx context.Context) (context.Context, error) {
+		if defaultResolverFactory == nil {
+			return nil, fmt.Errorf("default resolver factory is not set")
+		}
+		resolvers, err := defaultResolverFactory(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return WithResolvers(ctx, resolvers), nil
+	})
+}
+
+// Install sets JSONSerializer as the serializer of e and adds ResolversMiddleware with withResolvers,
+// which must be installed together for futures in responses to be resolved.
+func Install(e *echo.Echo, withResolvers func(context.Context) (context.Context, error)) error {
+	if withResolvers == nil {
+		return fmt.Errorf("withResolvers is nil")
+	}
+	e.JSONSerializer = NewJSONSerializer()
+	e.Use(ResolversMiddleware(withResolvers))
+	return nil
+}
+
 type JSONSerializer struct{}
 
 func NewJSONSerializer() *JSONSerializer {
@@ -39,11 +91,33 @@ func (j *JSONSerializer) Serialize(c echo.Context, i any, indent string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get resolvers: %w", err)
 	}
-	if err := rs.ResolveAll(c.Request().Context()); err != nil {
+	if err := resolveWithRegistered(c.Request().Context(), rs); err != nil {
 		return fmt.Errorf("failed to resolve resolvers: %w", err)
 	}
 	enc := json.NewEncoder(c.Response())
-	return enc.Encode(i)
+	return marshalInPass(func() error {
+		return enc.Encode(i)
+	})
+}
+
+// resolveWithRegistered resolves rs and the resolvers registered in ctx in turn until neither has
+// pending futures, as callbacks of either may create futures of the other.
+func resolveWithRegistered(ctx context.Context, rs ResolveAller) error {
+	for range 10 {
+		if err := rs.ResolveAll(ctx); err != nil {
+			return err
+		}
+		registered := RegisteredResolvers(ctx)
+		if lo.SumBy(registered, func(r ResolverSubset) int { return r.Count() }) == 0 {
+			return nil
+		}
+		if err := ResolveAll(ctx, registered...); err != nil {
+			return err
+		}
+	}
+	return &UnresolvedError{Resolvers: lo.FilterMap(RegisteredResolvers(ctx), func(r ResolverSubset, _ int) (UnresolvedResolver, bool) {
+		return UnresolvedResolver{Name: r.Name(), Count: r.Count()}, r.Count() > 0
+	})}
 }
 
 func (j *JSONSerializer) Deserialize(c echo.Context, i interface{}) error {
@@ -58,7 +132,7 @@ func (j *JSONSerializer) Deserialize(c echo.Context, i interface{}) error {
 
 func GetResolvers[T any](ctx context.Context) (T, error) {
 	var zero T
-	v := ctx.Value(ResolversKey)
+	v := ctx.Value(resolversKey)
 	if v == nil {
 		return zero, ErrResolverNotFound
 	}
@@ -66,7 +140,51 @@ func GetResolvers[T any](ctx context.Context) (T, error) {
 }
 
 func WithResolvers(ctx context.Context, resolvers any) context.Context {
-	return context.WithValue(ctx, ResolversKey, resolvers)
+	return context.WithValue(ctx, resolversKey, resolvers)
+}
+
+// WithQueryCounter returns a context counting the batches resolved with it, see QueryCount and
+// ContributingResolvers. ResolversMiddleware installs one for each request.
+func WithQueryCounter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryCounterKey, &queryCounter{names: map[string]struct{}{}})
+}
+
+type queryCounter struct {
+	count atomic.Int64
+	mu    sync.Mutex
+	names map[string]struct{}
+}
+
+func (q *queryCounter) add(name string) {
+	q.count.Add(1)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.names[name] = struct{}{}
+}
+
+// QueryCount returns the number of batches resolved with ctx, e.g. to assert in a test that
+// an endpoint loads each resolver in a single batch. It is 0 without WithQueryCounter.
+func QueryCount(ctx context.Context) int {
+	counter, ok := ctx.Value(queryCounterKey).(*queryCounter)
+	if !ok {
+		return 0
+	}
+	return int(counter.count.Load())
+}
+
+// ContributingResolvers returns the sorted names of the resolvers that resolved a batch with ctx,
+// e.g. to set cache headers of a response assembled from several resources. It is nil without
+// WithQueryCounter.
+func ContributingResolvers(ctx context.Context) []string {
+	counter, ok := ctx.Value(queryCounterKey).(*queryCounter)
+	if !ok {
+		return nil
+	}
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	names := lo.Keys(counter.names)
+	slices.Sort(names)
+	return names
 }
 
 var ErrResolverNotFound = fmt.Errorf("resolver not found")
@@ -75,27 +193,86 @@ type ResolveAller interface {
 	ResolveAll(context.Context) error
 }
 
-func ResolveAll(ctx context.Context, resolvers ...ResolverSubset) error {
+// Wait resolves r until none of its futures is pending, without resolving other resolvers,
+// e.g. to use values in a handler before responding. It waits for a Resolve of r in progress
+// in another goroutine to finish.
+func Wait(ctx context.Context, r ResolverSubset) error {
 	for range 10 {
-		for _, r := range resolvers {
-			if err := r.Resolve(ctx); err != nil {
+		if err := r.Resolve(ctx); err != nil {
+			return err
+		}
+		if r.Count() == 0 {
+			return nil
+		}
+	}
+	return &UnresolvedError{Resolvers: []UnresolvedResolver{{Name: r.Name(), Count: r.Count()}}}
+}
+
+var ErrDuplicateResolverName = fmt.Errorf("duplicate resolver name")
+
+// ResolveAll resolves resolvers in passes until no future is pending. It is a no-op when nothing
+// is pending, so a handler may call it before the serializer does without loading anything twice.
+// Resolvers must have unique names, so that errors tell which one failed; see WithName.
+func ResolveAll(ctx context.Context, resolvers ...ResolverSubset) error {
+	return resolveAll(ctx, resolvers, nil, nil)
+}
+
+// resolveAll is ResolveAll resolving each pass with pool unless it is nil, calling afterPass with
+// the 1-based number of each pass and the futures still pending after it.
+func resolveAll(ctx context.Context, resolvers []ResolverSubset, pool *Pool, afterPass func(pass, remain int)) error {
+	if dups := lo.FindDuplicates(lo.Map(resolvers, func(r ResolverSubset, _ int) string {
+		return r.Name()
+	})); len(dups) > 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateResolverName, strings.Join(dups, ", "))
+	}
+	pending := lo.SumBy(resolvers, func(r ResolverSubset) int {
+		return r.Count()
+	})
+	if pending == 0 {
+		return nil
+	}
+	for pass := range 10 {
+		if pool != nil {
+			if err := pool.resolvePass(ctx, resolvers); err != nil {
 				return err
 			}
+		} else {
+			for _, r := range resolvers {
+				if err := r.Resolve(ctx); err != nil {
+					return err
+				}
+			}
 		}
 		remain := lo.SumBy(resolvers, func(r ResolverSubset) int {
 			return r.Count()
 		})
+		if afterPass != nil {
+			afterPass(pass+1, remain)
+		}
 		if remain == 0 {
 			return nil
 		}
 	}
-	errs := lo.FlatMap(resolvers, func(r ResolverSubset, _ int) []error {
-		if r.Count() == 0 {
-			return nil
-		}
-		return []error{fmt.Errorf("resolver=%s, count=%d", r.Name(), r.Count())}
-	})
-	return fmt.Errorf("has unresolved resolvers: %w", errors.Join(errs...))
+	return &UnresolvedError{Resolvers: lo.FilterMap(resolvers, func(r ResolverSubset, _ int) (UnresolvedResolver, bool) {
+		return UnresolvedResolver{Name: r.Name(), Count: r.Count()}, r.Count() > 0
+	})}
+}
+
+// UnresolvedError is returned when futures are still pending after the passes of ResolveAll or Wait,
+// e.g. because resolvers keep creating futures of each other.
+type UnresolvedError struct {
+	Resolvers []UnresolvedResolver
+}
+
+type UnresolvedResolver struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func (e *UnresolvedError) Error() string {
+	return "has unresolved resolvers: " + strings.Join(lo.Map(e.Resolvers, func(r UnresolvedResolver, _ int) string {
+		return fmt.Sprintf("resolver=%s, count=%d", r.Name, r.Count)
+	}), "\n")
 }
 
 type ResolverSubset interface {
@@ -104,33 +281,309 @@ type ResolverSubset interface {
 	Count() int
 }
 
-func NewResolver[T any, Key comparable](name string, resolve func(context.Context, []Key) ([]T, error)) Resolver[T, Key] {
-	return &resolverImpl[T, Key]{_name: name, _resolve: resolve, resolvedMap: map[Key]T{}}
+// Prefixed namespaces the name of r as prefix.name, e.g. to tell apart resolvers of different packages in errors
+// and in the names of the spans of its batches.
+func Prefixed(prefix string, r ResolverSubset) ResolverSubset {
+	return &prefixedResolver{ResolverSubset: r, prefix: prefix}
+}
+
+// WithName renames r as name in errors and span names, e.g. to tell apart two resolvers of the same loader.
+func WithName(r ResolverSubset, name string) ResolverSubset {
+	return &namedResolver{ResolverSubset: r, name: name}
+}
+
+type namedResolver struct {
+	ResolverSubset
+	name string
+}
+
+func (n *namedResolver) Name() string {
+	return n.name
+}
+
+func (n *namedResolver) Resolve(ctx context.Context) error {
+	return n.ResolverSubset.Resolve(withResolverName(ctx, n.Name()))
+}
+
+type prefixedResolver struct {
+	ResolverSubset
+	prefix string
+}
+
+func (p *prefixedResolver) Name() string {
+	return p.prefix + "." + p.ResolverSubset.Name()
+}
+
+func (p *prefixedResolver) Resolve(ctx context.Context) error {
+	return p.ResolverSubset.Resolve(withResolverName(ctx, p.Name()))
+}
+
+// withResolverName names the spans of the batches resolved with ctx as name, unless an outer
+// wrapper already did, as its name includes those of the wrappers it wraps.
+func withResolverName(ctx context.Context, name string) context.Context {
+	if n, _ := ctx.Value(resolverNameKey).(string); n != "" {
+		return ctx
+	}
+	return context.WithValue(ctx, resolverNameKey, name)
+}
+
+type ResolverOption func(*resolverOptions)
+
+type resolverOptions struct {
+	eager     bool
+	spanLinks bool
+	drain     int
+	lruSize   int
+	ttl       time.Duration
+
+	resolveOnMarshal bool
+
+	chunkSize        int
+	chunkConcurrency int
+
+	compression          bool
+	compressionThreshold int
+}
+
+// WithEagerMode makes Future resolve its key immediately instead of waiting for ResolveAll, in a
+// batch of that key only, even while the resolver is resolving other futures. It is intended for
+// migrating eager code to futures one call site at a time. Future resolves with
+// context.Background(); create futures with FutureContext to resolve them with a request context,
+// counted by QueryCount and traced in its span. A failed future fails Get with the error and stays
+// pending for the next Resolve.
+func WithEagerMode(eager bool) ResolverOption {
+	return func(o *resolverOptions) {
+		o.eager = eager
+	}
+}
+
+// WithResolveOnMarshal makes MarshalJSON of a pending future resolve the futures of its resolver
+// instead of failing, for responses marshaled without ResolveAll, e.g. by a partial render.
+// Each resolver is then loaded when its first future is marshaled, so futures created by callbacks
+// of other resolvers, or of the same one after the batch, are loaded one batch at a time: an N+1
+// that ResolveAll would avoid. The batch is resolved with context.Background().
+func WithResolveOnMarshal(resolveOnMarshal bool) ResolverOption {
+	return func(o *resolverOptions) {
+		o.resolveOnMarshal = resolveOnMarshal
+	}
+}
+
+// WithDrain makes Resolve load the futures registered on the resolver itself by the callbacks
+// of a batch, e.g. the parent of a comment, in up to maxBatches batches in total instead of
+// leaving them to the next pass of ResolveAll.
+func WithDrain(maxBatches int) ResolverOption {
+	return func(o *resolverOptions) {
+		o.drain = maxBatches
+	}
+}
+
+// WithFilter adapts a resolve function so that the values for which keep returns false are dropped,
+// e.g. soft-deleted rows: NewResolver("user", WithFilter(fetchUsers, isActive)). Futures of
+// dropped values resolve to the zero value of T, which marshals to null for pointer types.
+func WithFilter[T any, Key comparable](resolve func(context.Context, []Key) ([]T, error), keep func(T) bool) func(context.Context, []Key) ([]T, error) {
+	return func(ctx context.Context, keys []Key) ([]T, error) {
+		vs, err := resolve(ctx, keys)
+		return lo.Map(vs, func(v T, _ int) T {
+			if keep(v) {
+				return v
+			}
+			var zero T
+			return zero
+		}), err
+	}
+}
+
+// WithMapper adapts a resolve function that scans into an intermediate row type so that
+// each row is mapped to the domain value, e.g. NewResolver("user", WithMapper(fetchUserRows, toUser)).
+func WithMapper[Row, T any, Key comparable](resolve func(context.Context, []Key) ([]Row, error), mapper func(Row) T) func(context.Context, []Key) ([]T, error) {
+	return func(ctx context.Context, keys []Key) ([]T, error) {
+		rows, err := resolve(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		return lo.Map(rows, func(row Row, _ int) T {
+			return mapper(row)
+		}), nil
+	}
+}
+
+// NewResolver returns a resolver loading the keys of its pending futures with one call of resolve
+// per batch. resolve returns the values aligned with keys; a missing trailing value fails the future
+// of its key with a KeyNotFoundError. The keys slice is reused across batches of a single key, so
+// resolve must not retain or modify it after returning; copy it to keep it.
+func NewResolver[T any, Key comparable](name string, resolve func(context.Context, []Key) ([]T, error), opts ...ResolverOption) Resolver[T, Key] {
+	return newResolver(name, resolve, opts...)
+}
+
+func newResolver[T any, Key comparable](name string, resolve func(context.Context, []Key) ([]T, error), opts ...ResolverOption) *resolverImpl[T, Key] {
+	var o resolverOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	r := &resolverImpl[T, Key]{_name: name, _resolve: resolve, store: mapStore[T, Key]{}, opts: o}
+	if o.chunkSize > 0 && resolve != nil {
+		r._load = parallelChunks(name, resolve, o.chunkSize, o.chunkConcurrency)
+	}
+	if o.lruSize > 0 || o.ttl > 0 {
+		r.store = newLRUTTLStore[T, Key](o.lruSize, o.ttl)
+	}
+	if o.compression {
+		r.store = &compressingStore[T, Key]{store: r.store, threshold: o.compressionThreshold}
+	}
+	return r
 }
 
 type resolverImpl[T any, Key comparable] struct {
-	_name       string
-	_resolve    func(context.Context, []Key) ([]T, error)
-	futures     []*Future[T, Key]
-	resolvedMap map[Key]T
+	_name    string
+	_resolve func(context.Context, []Key) ([]T, error)
+	futures  []*Future[T, Key]
+	store    valueStore[T, Key]
+	opts     resolverOptions
+	// mu guards futures and store, resolveMu serializes Resolve
+	mu        sync.Mutex
+	resolveMu sync.Mutex
+	// singleKey is reused as the keys of batches of one key, guarded by resolveMu;
+	// _resolve must not retain keys after returning
+	singleKey [1]Key
+
+	// _load replaces _resolve for loaders reporting an error per key, see FromLoader
+	_load func(context.Context, []Key) ([]Result[T], error)
 }
 
 func (r *resolverImpl[T, Key]) Resolve(ctx context.Context) error {
-	if len(r.futures) == 0 {
-		return nil
+	r.resolveMu.Lock()
+	defer r.resolveMu.Unlock()
+	return r.resolveLocked(ctx)
+}
+
+func (r *resolverImpl[T, Key]) resolveLocked(ctx context.Context) error {
+	for range max(r.opts.drain, 1) {
+		if r.Count() == 0 {
+			return nil
+		}
+		if err := r.resolveBatch(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *resolverImpl[T, Key]) resolveBatch(ctx context.Context) error {
+	// futures registered from now on, including by callbacks, form the next batch
+	r.mu.Lock()
+	futures := r.futures
+	r.futures = nil
+	r.mu.Unlock()
+	var keys []Key
+	if len(futures) == 1 {
+		// resolvers are mostly called with one key at a time, so spare the allocation
+		r.singleKey[0] = futures[0].key
+		keys = r.singleKey[:]
+	} else {
+		keys = lo.Map(futures, func(f *Future[T, Key], _ int) Key {
+			return f.key
+		})
+	}
+	return r.loadBatch(ctx, futures, keys)
+}
+
+// loadBatch loads keys, the keys of futures, settling them or putting them back on failure.
+func (r *resolverImpl[T, Key]) loadBatch(ctx context.Context, futures []*Future[T, Key], keys []Key) (err error) {
+	deferred, _ := ctx.Value(deferredSettleKey).(*[]func())
+	if deferred != nil {
+		// only the futures of this batch are settled by the caller, not those resolve waits for
+		ctx = context.WithValue(ctx, deferredSettleKey, (*[]func())(nil))
+	}
+	stats.recordBatch(r._name, len(keys))
+	if counter, ok := ctx.Value(queryCounterKey).(*queryCounter); ok {
+		counter.add(r._name)
+	}
+	var links []trace.SpanContext
+	if r.opts.spanLinks {
+		links = creationSpans(futures)
+	}
+	spanName := r._name
+	if n, _ := ctx.Value(resolverNameKey).(string); n != "" {
+		spanName = n
+		// not the name of the resolvers resolve waits for
+		ctx = context.WithValue(ctx, resolverNameKey, "")
+	}
+	ctx, span := startResolveSpan(ctx, spanName, len(keys), links)
+	defer func() {
+		endResolveSpan(span, err)
+	}()
+	var vs []T
+	var errs []error
+	if r._load != nil {
+		var results []Result[T]
+		results, err = r._load(ctx, keys)
+		vs = lo.Map(results, func(res Result[T], _ int) T { return res.Value })
+		errs = lo.Map(results, func(res Result[T], _ int) error { return res.Err })
+	} else {
+		vs, err = r._resolve(ctx, keys)
+	}
+	partial := errors.Is(err, ErrPartial)
+	if partial {
+		err = nil
 	}
-	keys := lo.Map(r.futures, func(f *Future[T, Key], _ int) Key {
-		return f.key
-	})
-	vs, err := r._resolve(ctx, keys)
 	if err != nil {
+		// keep them pending for a retry
+		r.mu.Lock()
+		r.futures = append(futures, r.futures...)
+		r.mu.Unlock()
 		return err
 	}
-	for i, v := range vs {
-		r.futures[i].resolvedCallback(v)
-		r.resolvedMap[keys[i]] = v
+	// fill the cache before callbacks, which may register new futures
+	values := make([]T, min(len(vs), len(futures)))
+	retry := func(i int) bool {
+		if i >= len(values) {
+			return partial
+		}
+		return errs != nil && errors.Is(errs[i], ErrPartial)
 	}
-	r.futures = nil
+	encoded := map[Key]*encodedValue{}
+	r.mu.Lock()
+	// the keys partial results lack are loaded again in the next pass
+	r.futures = append(lo.Filter(futures, func(_ *Future[T, Key], i int) bool {
+		return retry(i)
+	}), r.futures...)
+	for i := range values {
+		if errs != nil && errs[i] != nil {
+			// not cached, so that a later future loads it again
+			continue
+		}
+		values[i] = vs[i]
+		encoded[keys[i]] = &encodedValue{}
+		r.store.set(keys[i], &resolvedValue[T]{value: values[i], encoded: encoded[keys[i]]})
+	}
+	r.mu.Unlock()
+	now := time.Now()
+	stats.recordLatencies(r._name, lo.FilterMap(futures, func(f *Future[T, Key], i int) (time.Duration, bool) {
+		return now.Sub(f.createdAt), !retry(i)
+	}))
+	settle := func() {
+		for i, f := range futures {
+			if retry(i) {
+				continue
+			}
+			if i >= len(values) {
+				f.errorCallback(&KeyNotFoundError{Resolver: r._name, Key: keys[i]})
+				continue
+			}
+			if errs != nil && errs[i] != nil {
+				f.errorCallback(errs[i])
+				continue
+			}
+			f.resolvedCallback(values[i], encoded[keys[i]])
+		}
+	}
+	if deferred != nil {
+		// keys may be singleKey, which the next batch of a drain overwrites before settle runs
+		keys = slices.Clone(keys)
+		*deferred = append(*deferred, settle)
+		return nil
+	}
+	settle()
 	return nil
 }
 
@@ -139,15 +592,47 @@ func (r *resolverImpl[T, Key]) Name() string {
 }
 
 func (r *resolverImpl[T, Key]) Future(key Key) *Future[T, Key] {
-	if v, ok := r.resolvedMap[key]; ok {
-		return NewResolvedFuture[T, Key](v)
+	return r.future(context.Background(), key)
+}
+
+// FutureContext is r.Future(key) recording the span active in ctx as the creation site of the
+// future, which the span of the batch loading it links to with WithSpanLinks, and resolving it
+// with ctx under WithEagerMode. For resolvers not
+// returned by NewResolver or a constructor returning it as is, it is r.Future(key).
+func FutureContext[T any, Key comparable](ctx context.Context, r Resolver[T, Key], key Key) *Future[T, Key] {
+	if impl, ok := r.(*resolverImpl[T, Key]); ok {
+		return impl.future(ctx, key)
+	}
+	return r.Future(key)
+}
+
+func (r *resolverImpl[T, Key]) future(ctx context.Context, key Key) *Future[T, Key] {
+	stats.recordFuture(r._name)
+	r.mu.Lock()
+	if v, ok := r.store.get(key); ok {
+		r.mu.Unlock()
+		return &Future[T, Key]{resolver: r, key: key, resolved: true, value: v.value, encoded: v.encoded}
+	}
+	f := &Future[T, Key]{resolver: r, key: key, createdAt: time.Now(), resolveOnMarshal: r.opts.resolveOnMarshal}
+	if r.opts.spanLinks {
+		f.spanContext = trace.SpanContextFromContext(ctx)
+	}
+	if r.opts.eager {
+		r.mu.Unlock()
+		// a batch of its own, without resolveMu, which a callback of a Resolve in progress holds
+		if err := r.loadBatch(ctx, []*Future[T, Key]{f}, []Key{key}); err != nil {
+			f.errorCallback(err)
+		}
+		return f
 	}
-	f := &Future[T, Key]{resolver: r, key: key}
 	r.futures = append(r.futures, f)
+	r.mu.Unlock()
 	return f
 }
 
 func (r *resolverImpl[T, Key]) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	return len(r.futures)
 }
 
@@ -156,31 +641,264 @@ type Resolver[T any, Key comparable] interface {
 	Name() string
 	Future(key Key) *Future[T, Key]
 	Count() int
+	// All iterates over the values resolved and still cached, without resolving pending futures
+	All() iter.Seq[T]
 }
 
 type Future[T any, Key comparable] struct {
 	resolver Resolver[T, Key]
 	key      Key
-	resolved bool
-	value    T
+	// mu guards resolved, value, err, encoded and listeners, as a future may be settled by a
+	// Resolve in another goroutine than the one registering callbacks or reading it
+	mu        sync.Mutex
+	resolved  bool
+	value     T
+	err       error
+	listeners []func()
+	encoded   *encodedValue
+	optional  bool
+	createdAt time.Time
+	// spanContext is the span the future was created in, see WithSpanLinks
+	spanContext trace.SpanContext
+
+	resolveOnMarshal bool
+}
+
+// encodedValue memoizes the JSON of a resolved value, shared by all futures of the key,
+// so that a value referenced from many items of a response is encoded only once. The JSON is
+// reused only within the marshal pass it was encoded in, see marshalInPass, so that a value
+// mutated after a response is encoded again for the next one.
+type encodedValue struct {
+	mu   sync.Mutex
+	pass uint64
+	b    []byte
+	err  error
+}
+
+var (
+	// marshalPass changes whenever a marshal pass starts or ends
+	marshalPass  atomic.Uint64
+	activePasses atomic.Int64
+)
+
+// marshalInPass calls marshal as a marshal pass, e.g. encoding a response, within which the JSON of
+// resolved values is memoized. Values must not be mutated while marshaling. Passes of concurrent
+// responses overlapping each other only encode values again.
+func marshalInPass(marshal func() error) error {
+	activePasses.Add(1)
+	marshalPass.Add(1)
+	defer func() {
+		marshalPass.Add(1)
+		activePasses.Add(-1)
+	}()
+	return marshal()
+}
+
+// marshal returns the JSON of v, memoized within a marshal pass.
+func (e *encodedValue) marshal(v any) ([]byte, error) {
+	if activePasses.Load() == 0 {
+		return json.Marshal(v)
+	}
+	pass := marshalPass.Load()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.pass != pass {
+		e.b, e.err = json.Marshal(v)
+		e.pass = pass
+	}
+	return e.b, e.err
 }
 
-func (f *Future[T, Key]) resolvedCallback(v T) {
+// resolvedCallback resolves f to v, whose memoized JSON is encoded unless it is nil.
+func (f *Future[T, Key]) resolvedCallback(v T, encoded *encodedValue) {
+	f.mu.Lock()
 	f.resolved = true
 	f.value = v
+	f.err = nil
+	if encoded != nil {
+		f.encoded = encoded
+	}
+	f.notifyLocked()
+}
+
+func (f *Future[T, Key]) errorCallback(err error) {
+	f.mu.Lock()
+	f.err = err
+	f.notifyLocked()
+}
+
+// notifyLocked calls the listeners of f after unlocking it, as they may read f.
+func (f *Future[T, Key]) notifyLocked() {
+	listeners := f.listeners
+	f.listeners = nil
+	f.mu.Unlock()
+	for _, l := range listeners {
+		l()
+	}
+}
+
+// onSettled calls fn once f is resolved or failed, immediately if it already is, in the goroutine
+// settling f or the caller's, after f is settled.
+func (f *Future[T, Key]) onSettled(fn func()) {
+	f.mu.Lock()
+	if f.resolved || f.err != nil {
+		f.mu.Unlock()
+		fn()
+		return
+	}
+	f.listeners = append(f.listeners, fn)
+	f.mu.Unlock()
+}
+
+// state returns the settled state of f.
+func (f *Future[T, Key]) state() (value T, resolved bool, err error, encoded *encodedValue) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.value, f.resolved, f.err, f.encoded
+}
+
+// OnResolved calls fn with the value once f is resolved.
+func (f *Future[T, Key]) OnResolved(fn func(T)) {
+	f.onSettled(func() {
+		if f.resolved {
+			fn(f.value)
+		}
+	})
+}
+
+// When returns a future for the value of r at the key pred picks from the value of f,
+// or for the zero value of U when pred reports false. For example, resolving the team of
+// a post's author only when the author is staff:
+//
+//	team := lazyresolve.When(author, teamResolver, func(u *User) (int, bool) {
+//		return u.TeamID, u.IsStaff
+//	})
+//
+// The dependent future is registered on r as soon as f resolves and is loaded in the next
+// pass of ResolveAll together with the others. To avoid N+1 queries, pass a resolver
+// shared by the request rather than loading from the backend inside pred.
+func When[T, U any, Key, UKey comparable](f *Future[T, Key], r Resolver[U, UKey], pred func(T) (UKey, bool)) *Future[U, UKey] {
+	d := &Future[U, UKey]{resolver: r}
+	f.onSettled(func() {
+		if f.err != nil {
+			d.errorCallback(f.err)
+			return
+		}
+		key, ok := pred(f.value)
+		if !ok {
+			var zero U
+			d.resolvedCallback(zero, nil)
+			return
+		}
+		d.key = key
+		// linked to where f was created, as the callback runs in no span of its own
+		inner := FutureContext(trace.ContextWithSpanContext(context.Background(), f.spanContext), r, key)
+		inner.onSettled(func() {
+			if inner.err != nil {
+				d.errorCallback(inner.err)
+				return
+			}
+			d.resolvedCallback(inner.value, nil)
+		})
+	})
+	return d
+}
+
+// Recover returns a future for the value of f, or for fallback(err) once f fails for its key,
+// e.g. with a KeyNotFoundError or an error of a FromLoader loader, so that the response marshals the fallback instead of failing.
+// An error of the whole batch fails ResolveAll before f is settled and is not recovered.
+func Recover[T any, Key comparable](f *Future[T, Key], fallback func(err error) T) *Future[T, Key] {
+	d := &Future[T, Key]{resolver: f.resolver, key: f.key, createdAt: f.createdAt, resolveOnMarshal: f.resolveOnMarshal}
+	f.onSettled(func() {
+		if f.err != nil {
+			d.resolvedCallback(fallback(f.err), nil)
+			return
+		}
+		d.resolvedCallback(f.value, f.encoded)
+	})
+	return d
 }
 
 var ErrNotResolved = fmt.Errorf("future not resolved")
 
+var ErrKeyNotFound = fmt.Errorf("key not found")
+
+// ErrPartial is returned by a resolve function, possibly wrapped, along with the values of the
+// first keys only, e.g. when the source is rate limited. The futures of the other keys stay pending
+// and are loaded again in the next pass of ResolveAll, up to its limit of passes. A FromLoader
+// loader may set it as the error of any key.
+var ErrPartial = fmt.Errorf("partial results")
+
+// KeyNotFoundError is set on a future whose key was not returned by the resolve function.
+type KeyNotFoundError struct {
+	Resolver string
+	Key      any
+}
+
+func (e *KeyNotFoundError) Error() string {
+	return fmt.Sprintf("key not found: resolver=%s, key=%v", e.Resolver, e.Key)
+}
+
+func (e *KeyNotFoundError) Unwrap() error {
+	return ErrKeyNotFound
+}
+
+func (f *Future[T, Key]) Get() (T, error) {
+	var zero T
+	value, resolved, err, _ := f.state()
+	if err != nil {
+		return zero, err
+	}
+	if !resolved {
+		return zero, fmt.Errorf("future not resolved: resolver=%s, key=%v, %w", f.resolver.Name(), f.key, ErrNotResolved)
+	}
+	return value, nil
+}
+
+// OptionalFuture makes f marshal to null when its key is not found, like a nil *Future field does,
+// and returns such a future for a nil f, so that optional DTO fields marshal the same either way.
+func OptionalFuture[T any, Key comparable](f *Future[T, Key]) *Future[T, Key] {
+	if f == nil {
+		return &Future[T, Key]{err: ErrKeyNotFound, optional: true}
+	}
+	f.optional = true
+	return f
+}
+
+// MarshalJSON marshals the resolved value. It fails for a future not resolved yet or failed,
+// except for a not found key of an OptionalFuture, which marshals to null.
 func (f *Future[T, Key]) MarshalJSON() ([]byte, error) {
-	if !f.resolved {
+	value, resolved, err, encoded := f.state()
+	if f.resolveOnMarshal && !resolved && err == nil {
+		if err := f.resolver.Resolve(context.Background()); err != nil {
+			return nil, fmt.Errorf("failed to resolve on marshal: resolver=%s, key=%v, %w", f.resolver.Name(), f.key, err)
+		}
+		value, resolved, err, encoded = f.state()
+	}
+	if f.optional && errors.Is(err, ErrKeyNotFound) {
+		return []byte("null"), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("future failed: resolver=%s, key=%v, %w", f.resolver.Name(), f.key, err)
+	}
+	if !resolved {
 		return nil, fmt.Errorf("future not resolved: resolver=%s, key=%v, %w", f.resolver.Name(), f.key, ErrNotResolved)
 	}
-	return json.Marshal(f.value)
+	if encoded != nil {
+		return encoded.marshal(value)
+	}
+	return json.Marshal(value)
 }
 
 type Futures[T any, Key comparable] []*Future[T, Key]
 
+// FuturesFor returns the futures of r for keys in the order of keys.
+func FuturesFor[T any, Key comparable](r Resolver[T, Key], keys []Key) Futures[T, Key] {
+	return lo.Map(keys, func(key Key, _ int) *Future[T, Key] {
+		return r.Future(key)
+	})
+}
+
 func SortByIndex[T any, Key comparable](items []T, keys []Key, index func(T) Key) []T {
 	keyToItem := lo.KeyBy(items, index)
 	return lo.Map(keys, func(key Key, _ int) T {
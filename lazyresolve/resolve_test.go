@@ -0,0 +1,306 @@
+package lazyresolve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/samber/lo"
+)
+
+func BenchmarkResolveKeys(b *testing.B) {
+	// a batch of one key reuses the keys slice of the resolver, unlike larger ones
+	for _, n := range []int{1, 2} {
+		b.Run(fmt.Sprintf("keys=%d", n), func(b *testing.B) {
+			var vs []int
+			r := NewResolver("identity", func(_ context.Context, keys []int) ([]int, error) {
+				vs = append(vs[:0], keys...)
+				return vs, nil
+			})
+			ctx := context.Background()
+			b.ReportAllocs()
+			for i := range b.N {
+				for k := range n {
+					r.Future(i*n + k)
+				}
+				if err := r.Resolve(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDrainDeferredSingleKeyBatches(t *testing.T) {
+	var r Resolver[*int, int]
+	var second *Future[*int, int]
+	r = NewResolver("pointer", func(_ context.Context, keys []int) ([]*int, error) {
+		if keys[0] == 1 {
+			// a batch of one key left for the drain, and key 1 not found
+			second = r.Future(2)
+			return nil, nil
+		}
+		v := keys[0]
+		return []*int{&v}, nil
+	}, WithDrain(2))
+	first := r.Future(1)
+	if err := ResolveAllWithPool(context.Background(), NewPool(1), r); err != nil {
+		t.Fatal(err)
+	}
+	var notFound *KeyNotFoundError
+	if _, err := first.Get(); !errors.As(err, &notFound) || notFound.Key != 1 {
+		t.Errorf("first batch: got %v, want a KeyNotFoundError of key 1", err)
+	}
+	if v, err := second.Get(); err != nil || *v != 2 {
+		t.Errorf("second batch: got %v, %v", v, err)
+	}
+	if b, err := json.Marshal(second); err != nil || string(b) != "2" {
+		t.Errorf("second batch marshaled to %s, %v", b, err)
+	}
+}
+
+func TestResolveAllErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// resolve returns the error to inspect, of ResolveAll or of a future after it
+		resolve func(ctx context.Context) error
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "key not found",
+			resolve: func(ctx context.Context) error {
+				r := NewResolver("prefix", func(_ context.Context, keys []int) ([]int, error) {
+					// a shorter slice leaves the futures of the last keys without a value
+					return nil, nil
+				})
+				f := r.Future(2)
+				if err := ResolveAll(ctx, r); err != nil {
+					return err
+				}
+				_, err := f.Get()
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrKeyNotFound) {
+					t.Errorf("got %v, want ErrKeyNotFound", err)
+				}
+				var notFound *KeyNotFoundError
+				if !errors.As(err, &notFound) {
+					t.Fatalf("got %v, want a KeyNotFoundError", err)
+				}
+				if notFound.Resolver != "prefix" || notFound.Key != 2 {
+					t.Errorf("got resolver=%s, key=%v, want prefix, 2", notFound.Resolver, notFound.Key)
+				}
+			},
+		},
+		{
+			name: "unresolved",
+			resolve: func(ctx context.Context) error {
+				var r Resolver[int, int]
+				r = NewResolver("chain", func(_ context.Context, keys []int) ([]int, error) {
+					// every pass leaves a future of the next key
+					for _, k := range keys {
+						r.Future(k + 1)
+					}
+					return keys, nil
+				})
+				r.Future(0)
+				return ResolveAll(ctx, newSquareResolver(), r)
+			},
+			check: func(t *testing.T, err error) {
+				var unresolved *UnresolvedError
+				if !errors.As(err, &unresolved) {
+					t.Fatalf("got %v, want an UnresolvedError", err)
+				}
+				want := []UnresolvedResolver{{Name: "chain", Count: 1}}
+				if !slices.Equal(unresolved.Resolvers, want) {
+					t.Errorf("got %v, want %v", unresolved.Resolvers, want)
+				}
+				if errors.Is(err, ErrKeyNotFound) {
+					t.Errorf("%v is ErrKeyNotFound", err)
+				}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, tt.resolve(context.Background()))
+		})
+	}
+}
+
+func TestRenamedResolvers(t *testing.T) {
+	// chain leaves a future of the next key after every pass, so that ResolveAll gives up
+	chain := func() Resolver[int, int] {
+		var r Resolver[int, int]
+		r = NewResolver("chain", func(_ context.Context, keys []int) ([]int, error) {
+			for _, k := range keys {
+				r.Future(k + 1)
+			}
+			return keys, nil
+		})
+		r.Future(0)
+		return r
+	}
+	for _, tt := range []struct {
+		name string
+		wrap func(ResolverSubset) ResolverSubset
+		want string
+	}{
+		{
+			name: "Prefixed",
+			wrap: func(r ResolverSubset) ResolverSubset { return Prefixed("users", r) },
+			want: "users.chain",
+		},
+		{
+			name: "WithName",
+			wrap: func(r ResolverSubset) ResolverSubset { return WithName(r, "followers") },
+			want: "followers",
+		},
+		{
+			name: "nested",
+			wrap: func(r ResolverSubset) ResolverSubset { return Prefixed("api", Prefixed("users", r)) },
+			want: "api.users.chain",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &recordingTracer{}
+			SetTracer(rt)
+			t.Cleanup(func() { SetTracer(nil) })
+
+			err := ResolveAll(context.Background(), tt.wrap(chain()))
+			var unresolved *UnresolvedError
+			if !errors.As(err, &unresolved) || len(unresolved.Resolvers) != 1 || unresolved.Resolvers[0].Name != tt.want {
+				t.Errorf("got %v, want an UnresolvedError of %s", err, tt.want)
+			}
+			if len(rt.names) == 0 {
+				t.Fatal("no span started")
+			}
+			for _, name := range rt.names {
+				if name != "lazyresolve.Resolve "+tt.want {
+					t.Errorf("span %q, want it named after %s", name, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWhen(t *testing.T) {
+	type author struct {
+		TeamID int
+		Staff  bool
+	}
+	errFailed := errors.New("failed")
+	for _, tt := range []struct {
+		name string
+		// fails is the author whose key fails
+		fails int
+		// chained resolves the leader of each team with another When on the team future
+		chained bool
+		// want is the value or error of the future of each of the authors 1 to 4
+		want        []any
+		wantBatches int
+	}{
+		{
+			name:        "all resolved",
+			want:        []any{100, 0, 900, 0},
+			wantBatches: 2,
+		},
+		{
+			name:        "one error",
+			fails:       3,
+			want:        []any{100, 0, errFailed, 0},
+			wantBatches: 2,
+		},
+		{
+			name:        "callback registering futures",
+			chained:     true,
+			want:        []any{10000, 0, 810000, 0},
+			wantBatches: 3,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithQueryCounter(context.Background())
+			// odd authors are staff of team 10 * ID
+			authors := FromLoader("author", func(_ context.Context, keys []int) ([]Result[author], error) {
+				return lo.Map(keys, func(k int, _ int) Result[author] {
+					if k == tt.fails {
+						return Result[author]{Err: errFailed}
+					}
+					return Result[author]{Value: author{TeamID: 10 * k, Staff: k%2 == 1}}
+				}), nil
+			})
+			teams := newSquareResolver()
+			leaders := NewResolver("leader", func(_ context.Context, keys []int) ([]int, error) {
+				return lo.Map(keys, func(k int, _ int) int { return k * k }), nil
+			})
+			futures := lo.Map([]int{1, 2, 3, 4}, func(k int, _ int) *Future[int, int] {
+				team := When(authors.Future(k), teams, func(a author) (int, bool) {
+					return a.TeamID, a.Staff
+				})
+				if !tt.chained {
+					return team
+				}
+				// registered on leaders once team resolves, in the pass after the one of teams
+				return When(team, leaders, func(id int) (int, bool) {
+					return id, id != 0
+				})
+			})
+			if err := ResolveAll(ctx, authors, teams, leaders); err != nil {
+				t.Fatal(err)
+			}
+			for i, f := range futures {
+				v, err := f.Get()
+				switch want := tt.want[i].(type) {
+				case error:
+					if !errors.Is(err, want) {
+						t.Errorf("author %d: got %v, want %v", i+1, err, want)
+					}
+				case int:
+					if err != nil || v != want {
+						t.Errorf("author %d: got %v, %v, want %d", i+1, v, err, want)
+					}
+				}
+			}
+			// one batch per resolver, not per author
+			if got := QueryCount(ctx); got != tt.wantBatches {
+				t.Errorf("%d batches, want %d", got, tt.wantBatches)
+			}
+		})
+	}
+}
+
+func TestResolveAllPartial(t *testing.T) {
+	var batches [][]int
+	r := NewResolver("square", func(_ context.Context, keys []int) ([]int, error) {
+		batches = append(batches, slices.Clone(keys))
+		half := (len(keys) + 1) / 2
+		values := lo.Map(keys, func(k int, _ int) int { return k * k })
+		if len(batches) == 1 {
+			// rate limited, so only the first half is returned
+			return values[:half], fmt.Errorf("rate limited: %w", ErrPartial)
+		}
+		return values, nil
+	})
+	futures := FuturesFor(r, []int{1, 2, 3, 4})
+	ctx := context.Background()
+	if err := r.Resolve(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := futures[0].Get(); err != nil || r.Count() != 2 {
+		t.Errorf("after the first batch: %v, %d pending, want the second half pending", err, r.Count())
+	}
+	if err := ResolveAll(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{1, 2, 3, 4}, {3, 4}}; !slices.EqualFunc(batches, want, slices.Equal) {
+		t.Errorf("got batches %v, want %v", batches, want)
+	}
+	for i, f := range futures {
+		if v, err := f.Get(); err != nil || v != (i+1)*(i+1) {
+			t.Errorf("key %d: got %d, %v", i+1, v, err)
+		}
+	}
+}
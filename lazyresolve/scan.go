@@ -0,0 +1,42 @@
+package lazyresolve
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/samber/lo"
+)
+
+// NewScanResolver returns a resolver running query for a batch and scanning each row of the result
+// once with scan, matching the values to the keys by index instead of by position. A key without
+// a row resolves to the zero value of T.
+func NewScanResolver[T any, Key comparable](
+	name string,
+	query func(ctx context.Context, keys []Key) (*sql.Rows, error),
+	scan func(*sql.Rows) (T, error),
+	index func(T) Key,
+	opts ...ResolverOption,
+) Resolver[T, Key] {
+	return NewResolver(name, func(ctx context.Context, keys []Key) ([]T, error) {
+		rows, err := query(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		values := make(map[Key]T, len(keys))
+		for rows.Next() {
+			v, err := scan(rows)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan: %w", err)
+			}
+			values[index(v)] = v
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to iterate rows: %w", err)
+		}
+		return lo.Map(keys, func(key Key, _ int) T {
+			return values[key]
+		}), nil
+	}, opts...)
+}
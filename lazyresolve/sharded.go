@@ -0,0 +1,69 @@
+package lazyresolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// NewShardedResolver returns a resolver that partitions a batch by shardOf and calls resolve
+// once per shard, concurrently when concurrent is true. The values returned for a shard are
+// aligned with the keys passed for it; a missing value resolves to the zero value of T.
+func NewShardedResolver[T any, Key comparable](
+	name string,
+	shardOf func(Key) int,
+	resolve func(ctx context.Context, shard int, keys []Key) ([]T, error),
+	concurrent bool,
+	opts ...ResolverOption,
+) Resolver[T, Key] {
+	return NewResolver(name, func(ctx context.Context, keys []Key) ([]T, error) {
+		var shards []int
+		keysByShard := map[int][]Key{}
+		indexesByShard := map[int][]int{}
+		for i, key := range keys {
+			shard := shardOf(key)
+			if _, ok := keysByShard[shard]; !ok {
+				shards = append(shards, shard)
+			}
+			keysByShard[shard] = append(keysByShard[shard], key)
+			indexesByShard[shard] = append(indexesByShard[shard], i)
+		}
+
+		vs := make([]T, len(keys))
+		errs := make([]error, len(shards))
+		load := func(i, shard int) {
+			svs, err := resolve(ctx, shard, keysByShard[shard])
+			if err != nil {
+				errs[i] = fmt.Errorf("shard=%d: %w", shard, err)
+				return
+			}
+			indexes := indexesByShard[shard]
+			for j, v := range svs {
+				if j >= len(indexes) {
+					break
+				}
+				vs[indexes[j]] = v
+			}
+		}
+		if concurrent {
+			var wg sync.WaitGroup
+			for i, shard := range shards {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					load(i, shard)
+				}()
+			}
+			wg.Wait()
+		} else {
+			for i, shard := range shards {
+				load(i, shard)
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return vs, nil
+	}, opts...)
+}
@@ -0,0 +1,56 @@
+package lazyresolve
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/samber/lo"
+)
+
+func TestShardedResolver(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("concurrent=%t", concurrent), func(t *testing.T) {
+			dbs := make([]*sql.DB, 2)
+			drivers := make([]*keysDriver, 2)
+			for i := range dbs {
+				dbs[i], drivers[i] = openKeysDB(t)
+			}
+			r := NewShardedResolver("user", func(id int) int { return id % 2 }, func(ctx context.Context, shard int, ids []int) ([]testUser, error) {
+				rows, err := dbs[shard].QueryContext(ctx, inQuery(len(ids)), lo.ToAnySlice(ids)...)
+				if err != nil {
+					return nil, err
+				}
+				defer rows.Close()
+				var users []testUser
+				for rows.Next() {
+					var u testUser
+					if err := rows.Scan(&u.ID, &u.Name); err != nil {
+						return nil, err
+					}
+					users = append(users, u)
+				}
+				return users, rows.Err()
+			}, concurrent)
+			ctx := WithQueryCounter(context.Background())
+			futures := FuturesFor(r, []int{1, 2, 3, 4, 5})
+			if err := ResolveAll(ctx, r); err != nil {
+				t.Fatal(err)
+			}
+			for i, f := range futures {
+				if u, err := f.Get(); err != nil || u.ID != i+1 || u.Name != fmt.Sprintf("user%d", i+1) {
+					t.Errorf("key %d: got %v, %v", i+1, u, err)
+				}
+			}
+			if got := QueryCount(ctx); got != 1 {
+				t.Errorf("%d batches, want 1", got)
+			}
+			for shard, d := range drivers {
+				if got := d.prepares.Load(); got != 1 {
+					t.Errorf("shard %d: %d queries, want 1", shard, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package lazyresolve
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+)
+
+// batchSizeBuckets are the inclusive upper bounds of the batch size histogram.
+var batchSizeBuckets = []int{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, math.MaxInt}
+
+type ResolverStats struct {
+	Name    string `json:"name"`
+	Batches int    `json:"batches"`
+	Keys    int    `json:"keys"`
+	// Futures is the number of futures created, i.e. the round trips of loading each value on its own
+	Futures int `json:"futures"`
+	// SavedRoundTrips is Futures - Batches
+	SavedRoundTrips int               `json:"saved_round_trips"`
+	Histogram       []HistogramBucket `json:"histogram"`
+	Latency         ResolverLatency   `json:"latency"`
+}
+
+// ResolverLatency is the distribution of the time futures of a resolver spent pending,
+// from their creation to their resolution, over the latest maxLatencySamples futures.
+type ResolverLatency struct {
+	Name  string        `json:"name"`
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// maxLatencySamples bounds the pending durations kept per resolver.
+const maxLatencySamples = 10000
+
+// latencySamples is a ring buffer of the latest pending durations.
+type latencySamples struct {
+	count   int
+	samples []time.Duration
+}
+
+func (l *latencySamples) add(d time.Duration) {
+	if len(l.samples) < maxLatencySamples {
+		l.samples = append(l.samples, d)
+	} else {
+		l.samples[l.count%maxLatencySamples] = d
+	}
+	l.count++
+}
+
+func (l *latencySamples) percentiles(name string) ResolverLatency {
+	ret := ResolverLatency{Name: name, Count: l.count}
+	if len(l.samples) == 0 {
+		return ret
+	}
+	sorted := slices.Clone(l.samples)
+	slices.Sort(sorted)
+	at := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	ret.P50, ret.P90, ret.P99, ret.Max = at(50), at(90), at(99), sorted[len(sorted)-1]
+	return ret
+}
+
+type HistogramBucket struct {
+	Le    int `json:"le"`
+	Count int `json:"count"`
+}
+
+type statsRegistry struct {
+	mu        sync.Mutex
+	m         map[string]*ResolverStats
+	latencies map[string]*latencySamples
+}
+
+var stats = &statsRegistry{m: map[string]*ResolverStats{}, latencies: map[string]*latencySamples{}}
+
+func (r *statsRegistry) get(name string) *ResolverStats {
+	s, ok := r.m[name]
+	if !ok {
+		s = &ResolverStats{Name: name, Histogram: make([]HistogramBucket, len(batchSizeBuckets))}
+		for i, le := range batchSizeBuckets {
+			s.Histogram[i].Le = le
+		}
+		r.m[name] = s
+	}
+	return s
+}
+
+func (r *statsRegistry) recordBatch(name string, size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.get(name)
+	s.Batches++
+	s.Keys += size
+	i, _ := slices.BinarySearch(batchSizeBuckets, size)
+	s.Histogram[i].Count++
+}
+
+func (r *statsRegistry) recordFuture(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name).Futures++
+}
+
+func (r *statsRegistry) recordLatencies(name string, ds []time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name)
+	l, ok := r.latencies[name]
+	if !ok {
+		l = &latencySamples{}
+		r.latencies[name] = l
+	}
+	for _, d := range ds {
+		l.add(d)
+	}
+}
+
+// Latencies returns the distribution of the time futures spent pending per resolver, sorted by name.
+func Latencies() []ResolverLatency {
+	return lo.Map(Stats(), func(s ResolverStats, _ int) ResolverLatency {
+		return s.Latency
+	})
+}
+
+// Stats returns a snapshot of the statistics of all resolvers since the last ResetStats, sorted by name.
+func Stats() []ResolverStats {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	ret := make([]ResolverStats, 0, len(stats.m))
+	for _, s := range stats.m {
+		c := *s
+		c.Histogram = slices.Clone(s.Histogram)
+		c.SavedRoundTrips = c.Futures - c.Batches
+		c.Latency = ResolverLatency{Name: s.Name}
+		if l, ok := stats.latencies[s.Name]; ok {
+			c.Latency = l.percentiles(s.Name)
+		}
+		ret = append(ret, c)
+	}
+	slices.SortFunc(ret, func(a, b ResolverStats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return ret
+}
+
+func ResetStats() {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.m = map[string]*ResolverStats{}
+	stats.latencies = map[string]*latencySamples{}
+}
+
+func DumpStats(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Stats())
+}
+
+// StatsHandler responds with the resolver statistics. It writes the response directly
+// so that it works without ResolversMiddleware even when JSONSerializer is installed.
+func StatsHandler(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c.Response().WriteHeader(http.StatusOK)
+	return DumpStats(c.Response())
+}
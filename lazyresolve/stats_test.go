@@ -0,0 +1,71 @@
+package lazyresolve
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+func TestStatsHistogram(t *testing.T) {
+	r := NewResolver("histogram", func(_ context.Context, keys []int) ([]int, error) {
+		return keys, nil
+	})
+	ctx := context.Background()
+	next := 0
+	for _, size := range []int{1, 1, 2, 3, 5, 6, 20, 21, 1000, 1001} {
+		for range size {
+			r.Future(next)
+			next++
+		}
+		if err := r.Resolve(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, ok := lo.Find(Stats(), func(s ResolverStats) bool {
+		return s.Name == "histogram"
+	})
+	if !ok {
+		t.Fatal("no stats of the resolver")
+	}
+	want := []HistogramBucket{
+		{Le: 1, Count: 2},
+		{Le: 2, Count: 1},
+		{Le: 5, Count: 2},
+		{Le: 10, Count: 1},
+		{Le: 20, Count: 1},
+		{Le: 50, Count: 1},
+		{Le: 100, Count: 0},
+		{Le: 200, Count: 0},
+		{Le: 500, Count: 0},
+		{Le: 1000, Count: 1},
+		{Le: math.MaxInt, Count: 1},
+	}
+	if !slices.Equal(s.Histogram, want) {
+		t.Errorf("got histogram %v, want %v", s.Histogram, want)
+	}
+	if s.Batches != 10 || s.Keys != next || s.Futures != next {
+		t.Errorf("got batches=%d, keys=%d, futures=%d, want 10, %d, %d", s.Batches, s.Keys, s.Futures, next, next)
+	}
+}
+
+func TestStatsLatencies(t *testing.T) {
+	ds := make([]time.Duration, 100)
+	for i := range ds {
+		ds[i] = time.Duration(100-i) * time.Millisecond
+	}
+	stats.recordLatencies("latency", ds)
+	l, ok := lo.Find(Latencies(), func(l ResolverLatency) bool {
+		return l.Name == "latency"
+	})
+	if !ok {
+		t.Fatal("no latencies of the resolver")
+	}
+	want := ResolverLatency{Name: "latency", Count: 100, P50: 50 * time.Millisecond, P90: 90 * time.Millisecond, P99: 99 * time.Millisecond, Max: 100 * time.Millisecond}
+	if l != want {
+		t.Errorf("got %+v, want %+v", l, want)
+	}
+}
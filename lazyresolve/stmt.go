@@ -0,0 +1,122 @@
+package lazyresolve
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+// Preparer is implemented by *sql.DB, and by *sqlx.DB embedding it.
+type Preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// StmtCache prepares a statement per number of placeholders of a query like
+// `SELECT * FROM users WHERE id IN (?, ?, ?)`, whose arity varies with the batch size, and reuses
+// it across requests. It keeps at most size statements, evicting the one prepared first when full.
+// An evicted statement is closed once the queries running it return.
+// It is meant to be shared across requests and passed to NewScanResolver with PreparedQuery.
+type StmtCache struct {
+	db    Preparer
+	query func(placeholders int) string
+	size  int
+	mu    sync.Mutex
+	stmts map[int]*cachedStmt
+	order []int
+}
+
+// cachedStmt counts the queries running stmt, guarded by the mutex of the cache.
+type cachedStmt struct {
+	stmt    *sql.Stmt
+	users   int
+	evicted bool
+}
+
+// NewStmtCache returns a cache preparing query(n) for batches of n keys.
+func NewStmtCache(db Preparer, query func(placeholders int) string, size int) *StmtCache {
+	return &StmtCache{db: db, query: query, size: max(size, 1), stmts: map[int]*cachedStmt{}}
+}
+
+// acquire returns the statement for n placeholders, to be released once the query returns.
+func (c *StmtCache) acquire(ctx context.Context, n int) (*cachedStmt, error) {
+	c.mu.Lock()
+	if cs, ok := c.stmts[n]; ok {
+		cs.users++
+		c.mu.Unlock()
+		return cs, nil
+	}
+	c.mu.Unlock()
+	// prepared without the lock so that other arities are not blocked on the round trip
+	stmt, err := c.db.PrepareContext(ctx, c.query(n))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cs, ok := c.stmts[n]; ok {
+		// prepared concurrently
+		stmt.Close()
+		cs.users++
+		return cs, nil
+	}
+	if len(c.order) >= c.size {
+		c.evict(c.order[0])
+	}
+	cs := &cachedStmt{stmt: stmt, users: 1}
+	c.stmts[n] = cs
+	c.order = append(c.order, n)
+	return cs, nil
+}
+
+func (c *StmtCache) release(cs *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs.users--
+	if cs.evicted && cs.users == 0 {
+		cs.stmt.Close()
+	}
+}
+
+// evict removes the statement for n placeholders, closing it unless it is in use.
+func (c *StmtCache) evict(n int) error {
+	cs := c.stmts[n]
+	delete(c.stmts, n)
+	c.order = slices.DeleteFunc(c.order, func(m int) bool { return m == n })
+	cs.evicted = true
+	if cs.users > 0 {
+		return nil
+	}
+	return cs.stmt.Close()
+}
+
+// Close closes the cached statements, those in use once their queries return.
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for n := range c.stmts {
+		if err := c.evict(n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PreparedQuery returns a query for NewScanResolver running the statement of c prepared for the
+// number of keys, with the keys as its args.
+func PreparedQuery[Key any](c *StmtCache) func(ctx context.Context, keys []Key) (*sql.Rows, error) {
+	return func(ctx context.Context, keys []Key) (*sql.Rows, error) {
+		cs, err := c.acquire(ctx, len(keys))
+		if err != nil {
+			return nil, err
+		}
+		// rows being read stay valid after the statement is closed
+		defer c.release(cs)
+		return cs.stmt.QueryContext(ctx, lo.ToAnySlice(keys)...)
+	}
+}
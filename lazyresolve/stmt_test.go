@@ -0,0 +1,218 @@
+package lazyresolve
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// keysDriver answers a query with a row (id, "user<id>") per arg, counting the statements it
+// prepares and failing queries on closed ones.
+type keysDriver struct {
+	prepares atomic.Int64
+}
+
+func (d *keysDriver) Open(string) (driver.Conn, error) {
+	return &keysConn{d: d}, nil
+}
+
+type keysConn struct {
+	d *keysDriver
+}
+
+func (c *keysConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.prepares.Add(1)
+	return &keysStmt{inputs: strings.Count(query, "?")}, nil
+}
+
+func (c *keysConn) Close() error              { return nil }
+func (c *keysConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type keysStmt struct {
+	inputs int
+	closed atomic.Bool
+}
+
+func (s *keysStmt) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func (s *keysStmt) NumInput() int { return s.inputs }
+
+func (s *keysStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *keysStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.closed.Load() {
+		return nil, errors.New("driver statement is closed")
+	}
+	return &keysRows{args: args}, nil
+}
+
+type keysRows struct {
+	args []driver.Value
+	i    int
+}
+
+func (r *keysRows) Columns() []string { return []string{"id", "name"} }
+func (r *keysRows) Close() error      { return nil }
+
+func (r *keysRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.args) {
+		return io.EOF
+	}
+	dest[0] = r.args[r.i]
+	dest[1] = fmt.Sprintf("user%d", r.args[r.i])
+	r.i++
+	return nil
+}
+
+type testUser struct {
+	ID   int
+	Name string
+}
+
+var driverSeq atomic.Int64
+
+// openKeysDB opens a database of a new keysDriver.
+func openKeysDB(t testing.TB) (*sql.DB, *keysDriver) {
+	t.Helper()
+	d := &keysDriver{}
+	name := fmt.Sprintf("keys%d", driverSeq.Add(1))
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+func inQuery(n int) string {
+	return "SELECT id, name FROM users WHERE id IN (" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+func newUserScanResolver(query func(ctx context.Context, keys []int) (*sql.Rows, error)) Resolver[testUser, int] {
+	return NewScanResolver("user", query, func(rows *sql.Rows) (testUser, error) {
+		var u testUser
+		return u, rows.Scan(&u.ID, &u.Name)
+	}, func(u testUser) int { return u.ID })
+}
+
+// resolveUsers resolves users with the keys 1 to n through r, failing t on a wrong value.
+func resolveUsers(t testing.TB, r Resolver[testUser, int], n int) {
+	futures := make([]*Future[testUser, int], n)
+	for i := range futures {
+		futures[i] = r.Future(i + 1)
+	}
+	if err := ResolveAll(context.Background(), r); err != nil {
+		t.Error(err)
+		return
+	}
+	for i, f := range futures {
+		if u, err := f.Get(); err != nil || u.Name != fmt.Sprintf("user%d", i+1) {
+			t.Errorf("key %d: got %v, %v", i+1, u, err)
+		}
+	}
+}
+
+func TestStmtCacheEvictionWhileInUse(t *testing.T) {
+	db, d := openKeysDB(t)
+	// every other arity evicts the statement another goroutine may be running
+	c := NewStmtCache(db, inQuery, 1)
+	defer c.Close()
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				resolveUsers(t, newUserScanResolver(PreparedQuery[int](c)), 1+(g+i)%3)
+			}
+		}()
+	}
+	wg.Wait()
+	if d.prepares.Load() < 2 {
+		t.Errorf("prepares = %d, want statements evicted", d.prepares.Load())
+	}
+}
+
+func TestStmtCacheEvictedStmtClosedOnRelease(t *testing.T) {
+	db, _ := openKeysDB(t)
+	c := NewStmtCache(db, inQuery, 1)
+	ctx := context.Background()
+	one, err := c.acquire(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// evicts the statement for one key while it is in use
+	two, err := c.acquire(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.release(two)
+	rows, err := one.stmt.QueryContext(ctx, 1)
+	if err != nil {
+		t.Fatalf("evicted statement in use: %v", err)
+	}
+	rows.Close()
+	c.release(one)
+	if _, err := one.stmt.QueryContext(ctx, 1); err == nil {
+		t.Error("evicted statement not closed on release")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := two.stmt.QueryContext(ctx, 1, 2); err == nil {
+		t.Error("statement not closed by Close")
+	}
+}
+
+func TestStmtCacheReuse(t *testing.T) {
+	db, d := openKeysDB(t)
+	c := NewStmtCache(db, inQuery, 4)
+	defer c.Close()
+	for range 10 {
+		resolveUsers(t, newUserScanResolver(PreparedQuery[int](c)), 3)
+	}
+	if got := d.prepares.Load(); got != 1 {
+		t.Errorf("prepares = %d, want 1", got)
+	}
+}
+
+func BenchmarkStmtCache(b *testing.B) {
+	b.Run("unprepared", func(b *testing.B) {
+		db, d := openKeysDB(b)
+		r := func() Resolver[testUser, int] {
+			return newUserScanResolver(func(ctx context.Context, keys []int) (*sql.Rows, error) {
+				args := make([]any, len(keys))
+				for i, k := range keys {
+					args[i] = k
+				}
+				return db.QueryContext(ctx, inQuery(len(keys)), args...)
+			})
+		}
+		for range b.N {
+			resolveUsers(b, r(), 10)
+		}
+		b.ReportMetric(float64(d.prepares.Load())/float64(b.N), "prepares/op")
+	})
+	b.Run("cached", func(b *testing.B) {
+		db, d := openKeysDB(b)
+		c := NewStmtCache(db, inQuery, 4)
+		defer c.Close()
+		for range b.N {
+			resolveUsers(b, newUserScanResolver(PreparedQuery[int](c)), 10)
+		}
+		b.ReportMetric(float64(d.prepares.Load())/float64(b.N), "prepares/op")
+	})
+}
@@ -0,0 +1,135 @@
+package lazyresolve
+
+import (
+	"container/list"
+	"iter"
+	"maps"
+	"time"
+)
+
+// WithLRUTTL bounds the cache of resolved values to size entries, evicting the least recently used
+// one when full, and expires each entry ttl after it was resolved, e.g. for hot reference data held
+// by a long-lived resolver. Expired entries are evicted first. A non-positive size or ttl disables
+// the respective bound.
+func WithLRUTTL(size int, ttl time.Duration) ResolverOption {
+	return func(o *resolverOptions) {
+		o.lruSize = size
+		o.ttl = ttl
+	}
+}
+
+type resolvedValue[T any] struct {
+	value   T
+	encoded *encodedValue
+	// compressed is the gzipped JSON of the value in place of value, see WithCompression
+	compressed []byte
+}
+
+type valueStore[T any, Key comparable] interface {
+	get(key Key) (*resolvedValue[T], bool)
+	set(key Key, v *resolvedValue[T])
+	// all yields the stored values without marking them used
+	all() iter.Seq2[Key, *resolvedValue[T]]
+}
+
+type mapStore[T any, Key comparable] map[Key]*resolvedValue[T]
+
+func (m mapStore[T, Key]) get(key Key) (*resolvedValue[T], bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+func (m mapStore[T, Key]) set(key Key, v *resolvedValue[T]) {
+	m[key] = v
+}
+
+func (m mapStore[T, Key]) all() iter.Seq2[Key, *resolvedValue[T]] {
+	return maps.All(m)
+}
+
+type lruTTLEntry[T any, Key comparable] struct {
+	key       Key
+	value     *resolvedValue[T]
+	expiresAt time.Time
+	// positions in the recency and the expiry lists
+	recent *list.Element
+	expiry *list.Element
+}
+
+// lruTTLStore keeps entries in a list by recency of use and in a list by time of resolution.
+// As every entry has the same ttl, the front of the latter is the first to expire.
+type lruTTLStore[T any, Key comparable] struct {
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[Key]*lruTTLEntry[T, Key]
+	recent  *list.List
+	expiry  *list.List
+}
+
+func newLRUTTLStore[T any, Key comparable](size int, ttl time.Duration) *lruTTLStore[T, Key] {
+	return &lruTTLStore[T, Key]{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[Key]*lruTTLEntry[T, Key]{},
+		recent:  list.New(),
+		expiry:  list.New(),
+	}
+}
+
+func (s *lruTTLStore[T, Key]) get(key Key) (*resolvedValue[T], bool) {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if s.expired(e) {
+		s.remove(e)
+		return nil, false
+	}
+	s.recent.MoveToFront(e.recent)
+	return e.value, true
+}
+
+func (s *lruTTLStore[T, Key]) set(key Key, v *resolvedValue[T]) {
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+	if s.size > 0 && len(s.entries) >= s.size {
+		oldest := s.expiry.Front().Value.(*lruTTLEntry[T, Key])
+		if s.expired(oldest) {
+			s.remove(oldest)
+		} else {
+			s.remove(s.recent.Back().Value.(*lruTTLEntry[T, Key]))
+		}
+	}
+	e := &lruTTLEntry[T, Key]{key: key, value: v}
+	if s.ttl > 0 {
+		e.expiresAt = s.now().Add(s.ttl)
+	}
+	e.recent = s.recent.PushFront(e)
+	e.expiry = s.expiry.PushBack(e)
+	s.entries[key] = e
+}
+
+// all yields the entries from the most recently used one, skipping expired ones.
+func (s *lruTTLStore[T, Key]) all() iter.Seq2[Key, *resolvedValue[T]] {
+	return func(yield func(Key, *resolvedValue[T]) bool) {
+		for el := s.recent.Front(); el != nil; el = el.Next() {
+			e := el.Value.(*lruTTLEntry[T, Key])
+			if !s.expired(e) && !yield(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+func (s *lruTTLStore[T, Key]) expired(e *lruTTLEntry[T, Key]) bool {
+	return s.ttl > 0 && !s.now().Before(e.expiresAt)
+}
+
+func (s *lruTTLStore[T, Key]) remove(e *lruTTLEntry[T, Key]) {
+	s.recent.Remove(e.recent)
+	s.expiry.Remove(e.expiry)
+	delete(s.entries, e.key)
+}
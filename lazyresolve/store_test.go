@@ -0,0 +1,92 @@
+package lazyresolve
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// storedKeys returns the keys of s from the most recently used one.
+func storedKeys(s *lruTTLStore[int, int]) []int {
+	var keys []int
+	for k := range s.all() {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestLRUTTLStore(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		size int
+		ttl  time.Duration
+		// ops are applied a second apart: a positive key is set, a negative one is got
+		ops  []int
+		want []int
+	}{
+		{
+			name: "capacity evicts the least recently used",
+			size: 2,
+			ops:  []int{1, 2, -1, 3},
+			want: []int{3, 1},
+		},
+		{
+			name: "capacity evicts an expired entry first",
+			size: 2,
+			ttl:  3 * time.Second,
+			// 1 is used more recently than 2 but expires first
+			ops:  []int{1, 2, -1, 3},
+			want: []int{3, 2},
+		},
+		{
+			name: "ttl expires entries without eviction",
+			size: 10,
+			ttl:  2 * time.Second,
+			ops:  []int{1, 2, 3},
+			want: []int{3, 2},
+		},
+		{
+			name: "get does not extend the ttl",
+			ttl:  2 * time.Second,
+			ops:  []int{1, -1, -1},
+			want: nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			s := newLRUTTLStore[int, int](tt.size, tt.ttl)
+			s.now = func() time.Time { return now }
+			for _, op := range tt.ops {
+				now = now.Add(time.Second)
+				if op > 0 {
+					s.set(op, &resolvedValue[int]{value: op})
+				} else {
+					s.get(-op)
+				}
+			}
+			if got := storedKeys(s); !slices.Equal(got, tt.want) {
+				t.Errorf("got keys %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithLRUTTL(t *testing.T) {
+	var loads []int
+	r := NewResolver("square", func(_ context.Context, keys []int) ([]int, error) {
+		loads = append(loads, keys...)
+		return keys, nil
+	}, WithLRUTTL(1, time.Hour))
+	ctx := context.Background()
+	for _, k := range []int{1, 1, 2, 1} {
+		r.Future(k)
+		if err := ResolveAll(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 1 is cached once loaded, until 2 evicts it
+	if want := []int{1, 2, 1}; !slices.Equal(loads, want) {
+		t.Errorf("loaded %v, want %v", loads, want)
+	}
+}
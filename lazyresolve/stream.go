@@ -0,0 +1,103 @@
+package lazyresolve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+)
+
+// KeyValue is a value delivered by the source of a stream resolver.
+type KeyValue[T any, Key comparable] struct {
+	Key   Key
+	Value T
+}
+
+// NewStreamResolver returns a resolver for sources delivering the values of a batch incrementally
+// and in any order, e.g. a gRPC stream. Resolve drains the channel returned by fetch until every key
+// is delivered, the channel is closed or ctx is done. A key not delivered before the channel is
+// closed resolves to the zero value of T.
+func NewStreamResolver[T any, Key comparable](
+	name string,
+	fetch func(ctx context.Context, keys []Key) (<-chan KeyValue[T, Key], error),
+	opts ...ResolverOption,
+) Resolver[T, Key] {
+	return NewResolver(name, func(ctx context.Context, keys []Key) ([]T, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		// lets fetch stop sending once the batch is complete
+		defer cancel()
+		ch, err := fetch(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		pending := lo.SliceToMap(keys, func(key Key) (Key, struct{}) {
+			return key, struct{}{}
+		})
+		values := make(map[Key]T, len(pending))
+	loop:
+		for len(pending) > 0 {
+			select {
+			case kv, ok := <-ch:
+				if !ok {
+					break loop
+				}
+				values[kv.Key] = kv.Value
+				delete(pending, kv.Key)
+			case <-ctx.Done():
+				return nil, fmt.Errorf("stream interrupted: pending=%d, %w", len(pending), ctx.Err())
+			}
+		}
+		return lo.Map(keys, func(key Key, _ int) T {
+			return values[key]
+		}), nil
+	}, opts...)
+}
+
+// KeyResult is the value or the error delivered for a key by the source of a channel resolver.
+type KeyResult[T any, Key comparable] struct {
+	Key   Key
+	Value T
+	Err   error
+}
+
+// NewChannelResolver is NewStreamResolver for sources delivering an error per key, e.g. an event
+// driven backend answering each key on its own. A future whose key is delivered with an error fails
+// with it, and one whose key is not delivered before the channel is closed with a KeyNotFoundError.
+func NewChannelResolver[T any, Key comparable](
+	name string,
+	fetch func(ctx context.Context, keys []Key) (<-chan KeyResult[T, Key], error),
+	opts ...ResolverOption,
+) Resolver[T, Key] {
+	return FromLoader(name, func(ctx context.Context, keys []Key) ([]Result[T], error) {
+		ctx, cancel := context.WithCancel(ctx)
+		// lets fetch stop sending once the batch is complete
+		defer cancel()
+		ch, err := fetch(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		pending := lo.SliceToMap(keys, func(key Key) (Key, struct{}) {
+			return key, struct{}{}
+		})
+		results := make(map[Key]Result[T], len(pending))
+	loop:
+		for len(pending) > 0 {
+			select {
+			case kr, ok := <-ch:
+				if !ok {
+					break loop
+				}
+				results[kr.Key] = Result[T]{Value: kr.Value, Err: kr.Err}
+				delete(pending, kr.Key)
+			case <-ctx.Done():
+				return nil, fmt.Errorf("channel interrupted: pending=%d, %w", len(pending), ctx.Err())
+			}
+		}
+		return lo.Map(keys, func(key Key, _ int) Result[T] {
+			if res, ok := results[key]; ok {
+				return res
+			}
+			return Result[T]{Err: &KeyNotFoundError{Resolver: name, Key: key}}
+		}), nil
+	}, opts...)
+}
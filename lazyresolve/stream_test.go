@@ -0,0 +1,94 @@
+package lazyresolve
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestStreamResolver(t *testing.T) {
+	r := NewStreamResolver("square", func(ctx context.Context, keys []int) (<-chan KeyValue[int, int], error) {
+		ch := make(chan KeyValue[int, int])
+		go func() {
+			defer close(ch)
+			// out of order, and key 3 is never delivered
+			for _, k := range slices.Backward(keys) {
+				if k == 3 {
+					continue
+				}
+				select {
+				case ch <- KeyValue[int, int]{Key: k, Value: k * k}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return ch, nil
+	})
+	futures := FuturesFor(r, []int{1, 2, 3, 4})
+	if err := ResolveAll(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{1, 4, 0, 16} {
+		if v, err := futures[i].Get(); err != nil || v != want {
+			t.Errorf("key %d: got %v, %v, want %d", i+1, v, err, want)
+		}
+	}
+}
+
+func TestStreamResolverCanceled(t *testing.T) {
+	r := NewStreamResolver("square", func(context.Context, []int) (<-chan KeyValue[int, int], error) {
+		// never delivers
+		return make(chan KeyValue[int, int]), nil
+	})
+	r.Future(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ResolveAll(ctx, r); err == nil {
+		t.Error("resolved a canceled stream")
+	}
+}
+
+func TestChannelResolver(t *testing.T) {
+	errFailed := errors.New("failed")
+	r := NewChannelResolver("square", func(ctx context.Context, keys []int) (<-chan KeyResult[int, int], error) {
+		ch := make(chan KeyResult[int, int])
+		go func() {
+			defer close(ch)
+			// out of order, key 2 fails and key 3 is never delivered
+			for _, k := range slices.Backward(keys) {
+				res := KeyResult[int, int]{Key: k, Value: k * k}
+				switch k {
+				case 2:
+					res = KeyResult[int, int]{Key: k, Err: errFailed}
+				case 3:
+					continue
+				}
+				select {
+				case ch <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return ch, nil
+	})
+	futures := FuturesFor(r, []int{1, 2, 3, 4})
+	if err := ResolveAll(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []any{1, errFailed, ErrKeyNotFound, 16} {
+		v, err := futures[i].Get()
+		switch want := want.(type) {
+		case error:
+			if !errors.Is(err, want) {
+				t.Errorf("key %d: got %v, %v, want %v", i+1, v, err, want)
+			}
+		case int:
+			if err != nil || v != want {
+				t.Errorf("key %d: got %v, %v, want %d", i+1, v, err, want)
+			}
+		}
+	}
+}
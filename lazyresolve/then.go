@@ -0,0 +1,32 @@
+package lazyresolve
+
+// LoadThen returns a future for cont applied to the value of r at key, e.g. the name of a user:
+//
+//	name := lazyresolve.LoadThen(userResolver, post.UserID, func(u *User) string {
+//		return u.Name
+//	})
+//
+// The key is loaded in the batch of r like r.Future(key), and the future fails as that one does.
+func LoadThen[T, U any, Key comparable](r Resolver[T, Key], key Key, cont func(T) U) *Future[U, Key] {
+	return (&mappedResolver[T, U, Key]{Resolver: r, cont: cont}).Future(key)
+}
+
+// mappedResolver is the resolver of the futures of LoadThen, telling their source in errors and
+// resolving it for WithResolveOnMarshal.
+type mappedResolver[T, U any, Key comparable] struct {
+	Resolver[T, Key]
+	cont func(T) U
+}
+
+func (m *mappedResolver[T, U, Key]) Future(key Key) *Future[U, Key] {
+	f := m.Resolver.Future(key)
+	d := &Future[U, Key]{resolver: m, key: key, createdAt: f.createdAt, resolveOnMarshal: f.resolveOnMarshal}
+	f.onSettled(func() {
+		if f.err != nil {
+			d.errorCallback(f.err)
+			return
+		}
+		d.resolvedCallback(m.cont(f.value), nil)
+	})
+	return d
+}
@@ -0,0 +1,75 @@
+package lazyresolve
+
+import (
+	"context"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer trace.Tracer
+
+// SetTracer enables a span for each batch resolved by a resolver. Call it before serving requests.
+func SetTracer(t trace.Tracer) {
+	tracer = t
+}
+
+// WithSpanLinks links the span of each batch to the spans the futures it loads were created in
+// with FutureContext, e.g. the handler span, carrying the resolver name and the number of keys.
+// Futures created with Future have no creation site to link to.
+// It has no effect unless SetTracer is called.
+func WithSpanLinks(enabled bool) ResolverOption {
+	return func(o *resolverOptions) {
+		o.spanLinks = enabled
+	}
+}
+
+// creationSpans returns the distinct valid spans futures were created in.
+func creationSpans[T any, Key comparable](futures []*Future[T, Key]) []trace.SpanContext {
+	var spans []trace.SpanContext
+	for _, f := range futures {
+		if f.spanContext.IsValid() && !slices.ContainsFunc(spans, f.spanContext.Equal) {
+			spans = append(spans, f.spanContext)
+		}
+	}
+	return spans
+}
+
+func startResolveSpan(ctx context.Context, name string, keys int, links []trace.SpanContext) (context.Context, trace.Span) {
+	if tracer == nil {
+		// a non-recording span, so that ending it does not end the span in ctx
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("lazyresolve.resolver", name),
+		attribute.Int("lazyresolve.keys", keys),
+	}
+	opts := []trace.SpanStartOption{trace.WithAttributes(attrs...)}
+	for _, sc := range links {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sc, Attributes: attrs}))
+	}
+	return tracer.Start(ctx, "lazyresolve.Resolve "+name, opts...)
+}
+
+func endResolveSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ResolveAllWithEvents is ResolveAll adding a resolve.pass event to the span active in ctx after
+// each pass, carrying the number of the pass and of the futures still pending, to show in the
+// trace of a request how resolving converges.
+func ResolveAllWithEvents(ctx context.Context, resolvers ...ResolverSubset) error {
+	span := trace.SpanFromContext(ctx)
+	return resolveAll(ctx, resolvers, nil, func(pass, remain int) {
+		span.AddEvent("resolve.pass", trace.WithAttributes(
+			attribute.Int("lazyresolve.pass", pass),
+			attribute.Int("lazyresolve.remaining", remain),
+		))
+	})
+}
@@ -0,0 +1,65 @@
+package lazyresolve
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingTracer records the names and config of the spans it starts.
+type recordingTracer struct {
+	embedded.Tracer
+	names []string
+	spans []trace.SpanConfig
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.names = append(t.names, name)
+	t.spans = append(t.spans, trace.NewSpanStartConfig(opts...))
+	return ctx, noop.Span{}
+}
+
+func spanContext(id byte) trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{id},
+		SpanID:  trace.SpanID{id},
+	})
+}
+
+func TestWithSpanLinks(t *testing.T) {
+	rt := &recordingTracer{}
+	SetTracer(rt)
+	t.Cleanup(func() { SetTracer(nil) })
+
+	r := NewResolver("square", func(_ context.Context, keys []int) ([]int, error) {
+		return keys, nil
+	}, WithSpanLinks(true))
+	handler := trace.ContextWithSpanContext(context.Background(), spanContext(1))
+	other := trace.ContextWithSpanContext(context.Background(), spanContext(2))
+	FutureContext(handler, r, 1)
+	FutureContext(handler, r, 2)
+	FutureContext(other, r, 3)
+	r.Future(4)
+	// resolved in a span of its own, which is the parent rather than a link
+	resolving := trace.ContextWithSpanContext(context.Background(), spanContext(3))
+	if err := r.Resolve(resolving); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.spans) != 1 {
+		t.Fatalf("%d spans started, want 1", len(rt.spans))
+	}
+	links := rt.spans[0].Links()
+	if len(links) != 2 || !links[0].SpanContext.Equal(spanContext(1)) || !links[1].SpanContext.Equal(spanContext(2)) {
+		t.Fatalf("links = %v, want the spans the futures were created in", links)
+	}
+	attrs := map[string]any{}
+	for _, attr := range links[0].Attributes {
+		attrs[string(attr.Key)] = attr.Value.AsInterface()
+	}
+	if attrs["lazyresolve.resolver"] != "square" || attrs["lazyresolve.keys"] != int64(4) {
+		t.Errorf("link attributes = %v", attrs)
+	}
+}
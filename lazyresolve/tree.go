@@ -0,0 +1,77 @@
+package lazyresolve
+
+import (
+	"context"
+	"sync"
+
+	"github.com/samber/lo"
+)
+
+// TreeNode is a node of a self-referential hierarchy like a comment thread.
+type TreeNode[T any, Key comparable] struct {
+	Value    T                                 `json:"value"`
+	Children *Future[[]*TreeNode[T, Key], Key] `json:"children"`
+}
+
+// NewTreeResolver returns a resolver of the children of a parent key in a hierarchy referencing
+// itself by a parent id, e.g. comments by parent_id. children loads the rows whose parent is one
+// of parents. Resolve loads the descendants of the requested keys level by level, one call of
+// children per level, so that a whole tree is resolved within a single pass of ResolveAll.
+// The rows must form a tree; a cycle makes marshaling recurse infinitely.
+func NewTreeResolver[T any, Key comparable](
+	name string,
+	children func(ctx context.Context, parents []Key) ([]T, error),
+	idOf func(T) Key,
+	parentOf func(T) Key,
+	opts ...ResolverOption,
+) Resolver[[]*TreeNode[T, Key], Key] {
+	t := &treeResolver[T, Key]{idOf: idOf}
+	t.Resolver = NewResolver(name, func(ctx context.Context, parents []Key) ([][]*TreeNode[T, Key], error) {
+		rows, err := children(ctx, parents)
+		if err != nil {
+			return nil, err
+		}
+		nodesByParent := map[Key][]*TreeNode[T, Key]{}
+		nodes := make([]*TreeNode[T, Key], len(rows))
+		for i, row := range rows {
+			nodes[i] = &TreeNode[T, Key]{Value: row}
+			nodesByParent[parentOf(row)] = append(nodesByParent[parentOf(row)], nodes[i])
+		}
+		t.mu.Lock()
+		t.pending = append(t.pending, nodes...)
+		t.mu.Unlock()
+		return lo.Map(parents, func(parent Key, _ int) []*TreeNode[T, Key] {
+			if nodes, ok := nodesByParent[parent]; ok {
+				return nodes
+			}
+			return []*TreeNode[T, Key]{}
+		}), nil
+	}, opts...)
+	return t
+}
+
+type treeResolver[T any, Key comparable] struct {
+	Resolver[[]*TreeNode[T, Key], Key]
+	idOf func(T) Key
+	// mu guards pending, which the Resolve of another goroutine may load into
+	mu      sync.Mutex
+	pending []*TreeNode[T, Key]
+}
+
+func (t *treeResolver[T, Key]) Resolve(ctx context.Context) error {
+	for t.Count() > 0 {
+		err := t.Resolver.Resolve(ctx)
+		// register the children of the loaded level after the batch so that they form the next one
+		t.mu.Lock()
+		pending := t.pending
+		t.pending = nil
+		t.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		for _, node := range pending {
+			node.Children = t.Future(t.idOf(node.Value))
+		}
+	}
+	return nil
+}
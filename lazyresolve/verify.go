@@ -0,0 +1,113 @@
+package lazyresolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ResolveStruct runs ResolveAll and then verifies that no future reachable from v through
+// exported fields, slices, arrays, maps and pointers is left unresolved, whether held by pointer
+// or by value. The not found key of an OptionalFuture counts as resolved, as it marshals to null.
+// The returned error points at the offending field path, e.g. Posts[2].Author.
+func ResolveStruct(ctx context.Context, v any, resolvers ...ResolverSubset) error {
+	if err := ResolveAll(ctx, resolvers...); err != nil {
+		return err
+	}
+	return verifyResolved(reflect.ValueOf(v), "", map[uintptr]bool{})
+}
+
+type futureChecker interface {
+	checkResolved() error
+}
+
+// checkResolved fails like MarshalJSON would, except that it does not resolve on marshal.
+func (f *Future[T, Key]) checkResolved() error {
+	if _, resolved, err, _ := f.state(); f.resolver == nil && !resolved && err == nil {
+		// the zero value of a field holding a future by value
+		return fmt.Errorf("future of no resolver: %w", ErrNotResolved)
+	}
+	_, err := f.Get()
+	if f.optional && errors.Is(err, ErrKeyNotFound) {
+		// marshals to null
+		return nil
+	}
+	return err
+}
+
+var futureCheckerType = reflect.TypeFor[futureChecker]()
+
+func verifyResolved(rv reflect.Value, path string, visited map[uintptr]bool) error {
+	if !rv.IsValid() {
+		return nil
+	}
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() && rv.CanInterface() {
+		if fc, ok := rv.Interface().(futureChecker); ok {
+			if err := fc.checkResolved(); err != nil {
+				return fmt.Errorf("unresolved future at %s: %w", displayPath(path), err)
+			}
+			return nil
+		}
+	}
+	if rv.Kind() == reflect.Struct && reflect.PointerTo(rv.Type()).Implements(futureCheckerType) {
+		// a Future held by value
+		if !rv.CanAddr() {
+			c := reflect.New(rv.Type()).Elem()
+			c.Set(rv)
+			rv = c
+		}
+		return verifyResolved(rv.Addr(), path, visited)
+	}
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() || visited[rv.Pointer()] {
+			return nil
+		}
+		visited[rv.Pointer()] = true
+		return verifyResolved(rv.Elem(), path, visited)
+	case reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return verifyResolved(rv.Elem(), path, visited)
+	case reflect.Struct:
+		rt := rv.Type()
+		for i := range rt.NumField() {
+			if !rt.Field(i).IsExported() {
+				continue
+			}
+			if err := verifyResolved(rv.Field(i), joinPath(path, rt.Field(i).Name), visited); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range rv.Len() {
+			if err := verifyResolved(rv.Index(i), fmt.Sprintf("%s[%d]", path, i), visited); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := verifyResolved(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
@@ -0,0 +1,137 @@
+package lazyresolve
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type verifyAuthor struct {
+	Name   string
+	Avatar *Future[int, int]
+	// Rank is held by value, see futureValue
+	Rank Future[int, int]
+}
+
+type verifyPost struct {
+	Title  string
+	Author verifyAuthor
+	Editor *Future[int, int]
+}
+
+type verifyResponse struct {
+	Posts []verifyPost
+	// Authors holds futures in values that are not addressable
+	Authors map[string]verifyAuthor
+}
+
+// futureValue copies f into dst with reflection, as vet forbids copying the mutex of a future.
+func futureValue(dst *Future[int, int], f *Future[int, int]) {
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(f).Elem())
+}
+
+func TestResolveStruct(t *testing.T) {
+	newResolver := func() Resolver[int, int] {
+		// keys above 100 are not found
+		return NewResolver("rank", func(_ context.Context, keys []int) ([]int, error) {
+			values := make([]int, 0, len(keys))
+			for _, k := range keys {
+				if k > 100 {
+					break
+				}
+				values = append(values, k)
+			}
+			return values, nil
+		})
+	}
+	for _, tt := range []struct {
+		name string
+		// build returns the response before ResolveStruct resolves r
+		build    func(r Resolver[int, int]) *verifyResponse
+		wantPath string
+	}{
+		{
+			name: "resolved",
+			build: func(r Resolver[int, int]) *verifyResponse {
+				res := &verifyResponse{Posts: []verifyPost{{Author: verifyAuthor{Avatar: r.Future(1)}, Editor: r.Future(2)}}}
+				// a value future copied once resolved, as settling does not reach copies
+				f := r.Future(3)
+				if err := Wait(context.Background(), r); err != nil {
+					t.Fatal(err)
+				}
+				futureValue(&res.Posts[0].Author.Rank, f)
+				return res
+			},
+		},
+		{
+			name: "optional not found",
+			build: func(r Resolver[int, int]) *verifyResponse {
+				res := &verifyResponse{Posts: []verifyPost{{Author: verifyAuthor{Avatar: r.Future(1)}, Editor: OptionalFuture(r.Future(101))}}}
+				futureValue(&res.Posts[0].Author.Rank, OptionalFuture[int, int](nil))
+				return res
+			},
+		},
+		{
+			name: "not found",
+			build: func(r Resolver[int, int]) *verifyResponse {
+				res := &verifyResponse{Posts: []verifyPost{{Author: verifyAuthor{Avatar: r.Future(1)}}, {Author: verifyAuthor{Avatar: r.Future(102)}}}}
+				futureValue(&res.Posts[0].Author.Rank, OptionalFuture[int, int](nil))
+				futureValue(&res.Posts[1].Author.Rank, OptionalFuture[int, int](nil))
+				return res
+			},
+			wantPath: "Posts[1].Author.Avatar",
+		},
+		{
+			name: "value copied before resolving",
+			build: func(r Resolver[int, int]) *verifyResponse {
+				res := &verifyResponse{Posts: []verifyPost{{Author: verifyAuthor{Avatar: r.Future(1)}}}}
+				futureValue(&res.Posts[0].Author.Rank, r.Future(2))
+				return res
+			},
+			wantPath: "Posts[0].Author.Rank",
+		},
+		{
+			name: "map value",
+			build: func(r Resolver[int, int]) *verifyResponse {
+				var author verifyAuthor
+				futureValue(&author.Rank, r.Future(2))
+				res := &verifyResponse{Authors: map[string]verifyAuthor{}}
+				reflect.ValueOf(res.Authors).SetMapIndex(reflect.ValueOf("alice"), reflect.ValueOf(&author).Elem())
+				return res
+			},
+			wantPath: "Authors[alice].Rank",
+		},
+		{
+			name: "zero value",
+			build: func(r Resolver[int, int]) *verifyResponse {
+				return &verifyResponse{Posts: []verifyPost{{Author: verifyAuthor{Avatar: r.Future(1)}}}}
+			},
+			wantPath: "Posts[0].Author.Rank",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newResolver()
+			err := ResolveStruct(context.Background(), tt.build(r), r)
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "at "+tt.wantPath+":") {
+				t.Errorf("got %v, want an error at %s", err, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestResolveStructNotResolvedError(t *testing.T) {
+	var res verifyResponse
+	res.Posts = []verifyPost{{}}
+	err := ResolveStruct(context.Background(), &res)
+	if !errors.Is(err, ErrNotResolved) {
+		t.Errorf("got %v, want ErrNotResolved", err)
+	}
+}
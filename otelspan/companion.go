@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// companionSuffix is appended to the base name of a file to name the file of its wrappers.
+const companionSuffix = "_otel.go"
+
+// writeCompanion writes the wrappers of the functions of f that would be instrumented, like
+// tracedGetUser starting a span and calling GetUser, to the companion file of filename, leaving
+// f untouched. It reports whether a companion was written, i.e. any function is wrapped.
+func (in *instrumenter) writeCompanion(ctx context.Context, f *ast.File, filename string) (bool, error) {
+	var wrappers, originals []*ast.FuncDecl
+	for _, decl := range f.Decls {
+		x, ok := decl.(*ast.FuncDecl)
+		if !ok || x.Body == nil {
+			continue
+		}
+		w, ok := wrapperDecl(x)
+		if !ok {
+			in.skip(x.Pos(), x.Name.Name, skipWrongSignature, "generic function cannot be wrapped")
+			continue
+		}
+		insertions := in.insertions
+		if err := in.instrumentDecl(ctx, w); err != nil {
+			return false, err
+		}
+		if in.insertions == insertions {
+			continue
+		}
+		propagateSpanCtx(w)
+		w.Name = &ast.Ident{Name: wrapperName(x.Name.Name)}
+		w.Doc = nil
+		wrappers = append(wrappers, w)
+		originals = append(originals, x)
+	}
+	if len(wrappers) == 0 || !in.opts.Fix || in.opts.PrintCandidates {
+		return len(wrappers) > 0, nil
+	}
+
+	// the wrappers refer to packages in their signatures as the source file does
+	used := map[string]bool{}
+	for _, w := range wrappers {
+		ast.Inspect(w, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if x, ok := sel.X.(*ast.Ident); ok {
+					used[x.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	var src bytes.Buffer
+	src.WriteString(generatedHeader)
+	fmt.Fprintf(&src, "package %s\n\n", f.Name.Name)
+	// standard library packages first, like goimports groups them
+	var std, others []string
+	addImport := func(name, importPath string) {
+		spec := strconv.Quote(importPath)
+		if name != "" {
+			spec = name + " " + spec
+		}
+		if strings.Contains(strings.Split(importPath, "/")[0], ".") {
+			others = append(others, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	imported := map[string]bool{}
+	for _, spec := range f.Imports {
+		pkgName := in.info.PkgNameOf(spec)
+		if pkgName == nil || !used[pkgName.Name()] {
+			continue
+		}
+		var name string
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		addImport(name, pkgName.Imported().Path())
+		imported[pkgName.Imported().Path()] = true
+	}
+	for _, importPath := range []string{attributePkgPath, codesPkgPath, in.opts.TracerImport} {
+		if importPath == "" || imported[importPath] || !used[in.pkgName(importPath)] {
+			continue
+		}
+		var name string
+		if n := in.pkgName(importPath); n != path.Base(importPath) {
+			name = n
+		}
+		addImport(name, importPath)
+	}
+	fmt.Fprintf(&src, "import (\n%s\n\n%s\n)\n", strings.Join(std, "\n"), strings.Join(others, "\n"))
+	for i, w := range wrappers {
+		src.WriteString("\n")
+		fmt.Fprintf(&src, "// %s starts a span and calls %s.\n", w.Name.Name, originals[i].Name.Name)
+		if err := format.Node(&src, token.NewFileSet(), w); err != nil {
+			return false, fmt.Errorf("failed to format wrapper: func=%s, %w", w.Name.Name, err)
+		}
+		src.WriteString("\n")
+	}
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return false, fmt.Errorf("failed to format wrappers: %w", err)
+	}
+	out = in.withNolint(out)
+	target := strings.TrimSuffix(filename, ".go") + companionSuffix
+	if in.opts.PostFormat != "" {
+		if out, err = postFormat(ctx, in.opts.PostFormat, target, out); err != nil {
+			return false, err
+		}
+	}
+	if err := os.WriteFile(target, out, 0o644); err != nil {
+		return false, fmt.Errorf("failed to write file: %w", err)
+	}
+	return true, nil
+}
+
+// wrapperDecl returns a func with the doc, name and signature of x whose body forwards its
+// params to x, naming unnamed and blank params. Generic functions are not supported.
+func wrapperDecl(x *ast.FuncDecl) (*ast.FuncDecl, bool) {
+	if x.Type.TypeParams != nil {
+		return nil, false
+	}
+	var fun ast.Expr = &ast.Ident{Name: x.Name.Name}
+	var recv *ast.FieldList
+	if x.Recv != nil {
+		field := x.Recv.List[0]
+		if hasTypeParams(field.Type) {
+			return nil, false
+		}
+		name := "recv"
+		if len(field.Names) > 0 && field.Names[0].Name != "_" {
+			name = field.Names[0].Name
+		}
+		recv = &ast.FieldList{List: []*ast.Field{{Names: []*ast.Ident{{Name: name}}, Type: field.Type}}}
+		fun = &ast.SelectorExpr{X: &ast.Ident{Name: name}, Sel: &ast.Ident{Name: x.Name.Name}}
+	}
+
+	params := &ast.FieldList{}
+	call := &ast.CallExpr{Fun: fun}
+	n := 0
+	for _, field := range x.Type.Params.List {
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{{Name: "_"}}
+		}
+		var renamed []*ast.Ident
+		for _, name := range names {
+			n++
+			arg := name.Name
+			if arg == "_" {
+				arg = fmt.Sprintf("p%d", n)
+			}
+			renamed = append(renamed, &ast.Ident{Name: arg})
+			call.Args = append(call.Args, &ast.Ident{Name: arg})
+		}
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			call.Ellipsis = 1
+		}
+		params.List = append(params.List, &ast.Field{Names: renamed, Type: field.Type})
+	}
+
+	var body ast.Stmt = &ast.ExprStmt{X: call}
+	if x.Type.Results != nil && len(x.Type.Results.List) > 0 {
+		body = &ast.ReturnStmt{Results: []ast.Expr{call}}
+	}
+	var results *ast.FieldList
+	if x.Type.Results != nil {
+		// unnamed, as the body returns the call
+		results = &ast.FieldList{}
+		for _, field := range x.Type.Results.List {
+			for range max(len(field.Names), 1) {
+				results.List = append(results.List, &ast.Field{Type: field.Type})
+			}
+		}
+	}
+	return &ast.FuncDecl{
+		Doc:  x.Doc,
+		Recv: recv,
+		Name: x.Name,
+		Type: &ast.FuncType{Params: params, Results: results},
+		Body: &ast.BlockStmt{List: []ast.Stmt{body}},
+	}, true
+}
+
+// propagateSpanCtx makes the span started by the wrapper w the parent of the spans of the function
+// it calls, passing on the ctx of the span, through the request of the echo.Context for handlers:
+//
+//	ctx := c.Request().Context()
+//	ctx, span := tracer.Start(ctx, "GetUser")
+//	defer span.End()
+//	c.SetRequest(c.Request().WithContext(ctx))
+//	return GetUser(c)
+//
+// The span of a param of a custom context type is not passed on, as it cannot be assigned the
+// context.Context of the span.
+func propagateSpanCtx(w *ast.FuncDecl) {
+	i := slices.IndexFunc(w.Body.List, isSpanStart)
+	if i < 0 {
+		return
+	}
+	start := w.Body.List[i].(*ast.AssignStmt)
+	if !isIdent(start.Rhs[0].(*ast.CallExpr).Args[0], "ctx") {
+		return
+	}
+	start.Lhs[0] = &ast.Ident{Name: "ctx"}
+	if echoVar, ok := tracedParam(w.Type); ok && echoVar {
+		request := func() ast.Expr {
+			return &ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "c"}, Sel: &ast.Ident{Name: "Request"}}}
+		}
+		setRequest := &ast.ExprStmt{X: &ast.CallExpr{
+			Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "c"}, Sel: &ast.Ident{Name: "SetRequest"}},
+			Args: []ast.Expr{&ast.CallExpr{
+				Fun:  &ast.SelectorExpr{X: request(), Sel: &ast.Ident{Name: "WithContext"}},
+				Args: []ast.Expr{&ast.Ident{Name: "ctx"}},
+			}},
+		}}
+		// after defer span.End()
+		w.Body.List = slices.Insert(w.Body.List, i+2, ast.Stmt(setRequest))
+	}
+}
+
+// hasTypeParams reports whether a receiver type like T[K] has type params.
+func hasTypeParams(expr ast.Expr) bool {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch expr.(type) {
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		return true
+	}
+	return false
+}
+
+// wrapperName returns the name of the wrapper of the func name, e.g. tracedGetUser for getUser.
+func wrapperName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return "traced" + string(unicode.ToUpper(r)) + name[size:]
+}
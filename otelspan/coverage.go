@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/samber/lo"
+)
+
+// Coverage is the summary written by -coverage-out of whether the functions taking
+// ctx context.Context or c echo.Context in the processed packages are traced.
+type Coverage struct {
+	Total  int            `json:"total"`
+	Traced int            `json:"traced"`
+	Funcs  []*CoveredFunc `json:"funcs"`
+}
+
+// CoveredFunc is traced if it started a span before the run, whether or not -fix adds one.
+type CoveredFunc struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Func     string `json:"func"`
+	Traced   bool   `json:"traced"`
+	pos      token.Position
+}
+
+// cover records a ctx or handler function for -coverage-out.
+func (in *instrumenter) cover(pos token.Pos, name string, traced bool) {
+	if in.opts.CoverageOut == "" {
+		return
+	}
+	p := in.fset.Position(pos)
+	in.covered = append(in.covered, &CoveredFunc{
+		Filename: p.Filename,
+		Line:     p.Line,
+		Func:     name,
+		Traced:   traced,
+		pos:      p,
+	})
+}
+
+// writeCoverage writes the coverage of funcs to filename, naming their files relative to dir.
+func writeCoverage(filename, dir string, funcs []*CoveredFunc) error {
+	// function literals are covered before their enclosing functions
+	slices.SortStableFunc(funcs, func(a, b *CoveredFunc) int {
+		return cmp.Or(cmp.Compare(a.pos.Filename, b.pos.Filename), cmp.Compare(a.pos.Offset, b.pos.Offset))
+	})
+	for _, f := range funcs {
+		if rel, err := filepath.Rel(dir, f.Filename); err == nil {
+			f.Filename = filepath.ToSlash(rel)
+		}
+	}
+	coverage := Coverage{
+		Total: len(funcs),
+		Traced: lo.CountBy(funcs, func(f *CoveredFunc) bool {
+			return f.Traced
+		}),
+		Funcs: lo.Ternary(funcs == nil, []*CoveredFunc{}, funcs),
+	}
+	b, err := json.MarshalIndent(coverage, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode coverage: %w", err)
+	}
+	if err := os.WriteFile(filename, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write coverage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// checkCtxPropagation reports calls made after a span is started in a function of f that pass
+// a ctx other than the one returned by Start, i.e. context.Background(), context.TODO() or a ctx
+// var the span is not in, which detaches the callee from the span. A ctx var declared after Start
+// from the span's ctx, e.g. by context.WithTimeout, is in the span. A span started as
+// `_, span := tracer.Start(ctx, ...)` discards its ctx, so every ctx passed after it is reported.
+func checkCtxPropagation(fset *token.FileSet, info *types.Info, f *ast.File) []string {
+	var findings []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		var body *ast.BlockStmt
+		switch x := n.(type) {
+		case *ast.FuncDecl:
+			body = x.Body
+		case *ast.FuncLit:
+			body = x.Body
+		}
+		if body == nil {
+			return true
+		}
+		for i, stmt := range body.List {
+			spanCtx, ok := spanStartCtx(info, stmt)
+			if !ok {
+				continue
+			}
+			inSpan := map[types.Object]bool{}
+			if spanCtx != nil {
+				inSpan[spanCtx] = true
+			}
+			for _, after := range body.List[i+1:] {
+				ast.Inspect(after, func(n ast.Node) bool {
+					switch x := n.(type) {
+					case *ast.FuncLit:
+						// checked on its own
+						return false
+					case *ast.AssignStmt:
+						derivedCtxs(info, x, inSpan)
+					case *ast.CallExpr:
+						for _, arg := range x.Args {
+							if msg, ok := staleCtx(info, arg, inSpan); ok {
+								findings = append(findings, fmt.Sprintf("%s: call to %s passes %s", fset.Position(arg.Pos()), types.ExprString(x.Fun), msg))
+							}
+						}
+					}
+					return true
+				})
+			}
+			break
+		}
+		return true
+	})
+	return findings
+}
+
+// spanStartCtx reports whether stmt starts a span like `ctx, span := tracer.Start(ctx, "name")`,
+// returning the var of the ctx the span is in, nil if it is discarded.
+func spanStartCtx(info *types.Info, stmt ast.Stmt) (types.Object, bool) {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 2 || len(assign.Rhs) != 1 {
+		return nil, false
+	}
+	call, ok := assign.Rhs[0].(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 || !isContext(info.TypeOf(call.Args[0])) {
+		return nil, false
+	}
+	if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "Start" {
+		return nil, false
+	}
+	ident, ok := assign.Lhs[0].(*ast.Ident)
+	if !ok {
+		return nil, false
+	}
+	return info.ObjectOf(ident), true
+}
+
+// derivedCtxs adds to inSpan the ctx vars assign declares from an expression referring to one of
+// inSpan, like `ctx, cancel := context.WithTimeout(ctx, d)`.
+func derivedCtxs(info *types.Info, assign *ast.AssignStmt, inSpan map[types.Object]bool) {
+	for i, lhs := range assign.Lhs {
+		ident, ok := lhs.(*ast.Ident)
+		if !ok || !isContext(info.TypeOf(ident)) {
+			continue
+		}
+		rhs := assign.Rhs[0]
+		if len(assign.Rhs) == len(assign.Lhs) {
+			rhs = assign.Rhs[i]
+		}
+		derived := false
+		ast.Inspect(rhs, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && inSpan[info.Uses[id]] {
+				derived = true
+			}
+			return !derived
+		})
+		if obj := info.ObjectOf(ident); obj != nil && derived {
+			inSpan[obj] = true
+		}
+	}
+}
+
+// staleCtx reports whether arg is a ctx not in inSpan, describing it.
+func staleCtx(info *types.Info, arg ast.Expr, inSpan map[types.Object]bool) (string, bool) {
+	if !isContext(info.TypeOf(arg)) {
+		return "", false
+	}
+	switch x := arg.(type) {
+	case *ast.CallExpr:
+		if fn, ok := typeutil.Callee(info, x).(*types.Func); ok && fn.Pkg() != nil && fn.Pkg().Path() == "context" {
+			if name := fn.Name(); name == "Background" || name == "TODO" {
+				return "context." + name + "() instead of the span's ctx", true
+			}
+		}
+	case *ast.Ident:
+		if obj := info.Uses[x]; obj != nil && !inSpan[obj] {
+			return x.Name + " which is not in the span", true
+		}
+	}
+	return "", false
+}
+
+func isContext(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == "context" && obj.Name() == "Context"
+}
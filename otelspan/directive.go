@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+const (
+	traceAttrDirective = "//elephandog:trace-attr "
+	nameDirective      = "//elephandog:name "
+	disableDirective   = "otelspan:disable"
+)
+
+// packageDisabled reports whether the package doc of any of files has an //otelspan:disable
+// directive, opting the whole package out of otelspan.
+func packageDisabled(files []*ast.File) bool {
+	for _, f := range files {
+		if f.Doc == nil {
+			continue
+		}
+		for _, c := range f.Doc.List {
+			if strings.TrimSpace(strings.TrimPrefix(c.Text, "//")) == disableDirective {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// spanName returns the span name given by a //elephandog:name "name" directive in doc.
+func spanName(doc *ast.CommentGroup) (string, bool, error) {
+	if doc == nil {
+		return "", false, nil
+	}
+	for _, c := range doc.List {
+		rest, ok := strings.CutPrefix(c.Text, nameDirective)
+		if !ok {
+			continue
+		}
+		name, err := strconv.Unquote(strings.TrimSpace(rest))
+		if err != nil {
+			return "", false, fmt.Errorf("invalid name, want a quoted string: %s", rest)
+		}
+		if name == "" {
+			return "", false, fmt.Errorf("invalid name, must not be empty")
+		}
+		return name, true, nil
+	}
+	return "", false, nil
+}
+
+// traceAttrs converts //elephandog:trace-attr key=value directives in doc to constructor calls of
+// the attribute package imported as attrPkg. The attribute type is inferred from the value: int, bool, or string otherwise.
+func traceAttrs(doc *ast.CommentGroup, attrPkg string) ([]ast.Expr, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	var attrs []ast.Expr
+	for _, c := range doc.List {
+		rest, ok := strings.CutPrefix(c.Text, traceAttrDirective)
+		if !ok {
+			continue
+		}
+		for _, kv := range strings.Fields(rest) {
+			key, value, ok := strings.Cut(kv, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("invalid trace-attr, want key=value: %s", kv)
+			}
+			attrs = append(attrs, attributeExpr(attrPkg, key, value))
+		}
+	}
+	return attrs, nil
+}
+
+func attributeExpr(attrPkg, key, value string) ast.Expr {
+	if _, err := strconv.Atoi(value); err == nil {
+		return attributeCall(attrPkg, "Int", key, &ast.BasicLit{Kind: token.INT, Value: value})
+	}
+	if value == "true" || value == "false" {
+		return attributeCall(attrPkg, "Bool", key, &ast.Ident{Name: value})
+	}
+	return attributeCall(attrPkg, "String", key, &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(value)})
+}
+
+func attributeCall(attrPkg, fn, key string, value ast.Expr) ast.Expr {
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   &ast.Ident{Name: attrPkg},
+			Sel: &ast.Ident{Name: fn},
+		},
+		Args: []ast.Expr{
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(key)},
+			value,
+		},
+	}
+}
+
+func setAttributesStmt(attrs []ast.Expr) ast.Stmt {
+	return &ast.ExprStmt{
+		X: &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X:   &ast.Ident{Name: "span"},
+				Sel: &ast.Ident{Name: "SetAttributes"},
+			},
+			Args: attrs,
+		},
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// postFormat pipes the content of filename through command, like gofumpt or goimports, run in the
+// directory of the file so that it finds the module and its configuration, returning its output.
+func postFormat(ctx context.Context, command, filename string, content []byte) ([]byte, error) {
+	args := strings.Fields(command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = filepath.Dir(filename)
+	cmd.Stdin = bytes.NewReader(content)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run post-format on %s: %w: %s", filename, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// generatedTag is the build tag selecting the files generated by -output-suffix over their sources.
+const generatedTag = "otelspan"
+
+const generatedHeader = "// Code generated by otelspan. DO NOT EDIT.\n\n"
+
+// writeGenerated writes the instrumented content of filename to its sibling with suffix, built with
+// the otelspan tag. filename is left untouched unless excludeSource, which excludes it from builds
+// with the tag so that both can be built with -tags otelspan.
+func writeGenerated(ctx context.Context, filename, suffix string, content []byte, excludeSource bool) error {
+	generated, err := withBuildTag(content, &constraint.TagExpr{Tag: generatedTag})
+	if err != nil {
+		return fmt.Errorf("failed to add build constraint: %w", err)
+	}
+	target := strings.TrimSuffix(filename, ".go") + suffix + ".go"
+	if err := os.WriteFile(target, append([]byte(generatedHeader), generated...), 0o644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if !excludeSource {
+		return nil
+	}
+
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	excluded, err := withBuildTag(src, &constraint.NotExpr{X: &constraint.TagExpr{Tag: generatedTag}})
+	if err != nil {
+		return fmt.Errorf("failed to add build constraint: %w", err)
+	}
+	if string(excluded) == string(src) {
+		return nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if err := os.WriteFile(filename, excluded, info.Mode()); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// withBuildTag returns src with tag and'ed to its //go:build constraint, replacing any otelspan
+// term added before, or with a //go:build tag line inserted at the top when it has none.
+func withBuildTag(src []byte, tag constraint.Expr) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if !constraint.IsGoBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				return nil, err
+			}
+			if expr = withoutGeneratedTag(expr); expr != nil {
+				tag = &constraint.AndExpr{X: expr, Y: tag}
+			}
+			start, end := fset.Position(c.Pos()).Offset, fset.Position(c.End()).Offset
+			return []byte(string(src[:start]) + "//go:build " + tag.String() + string(src[end:])), nil
+		}
+	}
+	return []byte("//go:build " + tag.String() + "\n\n" + string(src)), nil
+}
+
+// withoutGeneratedTag drops the otelspan terms and'ed to expr, returning nil if nothing remains.
+func withoutGeneratedTag(expr constraint.Expr) constraint.Expr {
+	switch x := expr.(type) {
+	case *constraint.TagExpr:
+		if x.Tag == generatedTag {
+			return nil
+		}
+	case *constraint.NotExpr:
+		if t, ok := x.X.(*constraint.TagExpr); ok && t.Tag == generatedTag {
+			return nil
+		}
+	case *constraint.AndExpr:
+		l, r := withoutGeneratedTag(x.X), withoutGeneratedTag(x.Y)
+		if l == nil {
+			return r
+		}
+		if r == nil {
+			return l
+		}
+		return &constraint.AndExpr{X: l, Y: r}
+	}
+	return expr
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changedFiles returns the absolute paths of the go files under dir changed since ref,
+// including uncommitted changes, as listed by git diff.
+func changedFiles(ctx context.Context, dir, ref string) (map[string]bool, error) {
+	cmd := exec.CommandContext(ctx, "git", "diff", "--name-only", "--relative", ref, "--", "*.go")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run git diff: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	files := map[string]bool{}
+	for _, name := range strings.Fields(string(out)) {
+		files[filepath.Join(dir, name)] = true
+	}
+	return files, nil
+}
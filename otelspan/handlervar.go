@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"go/ast"
+	"go/types"
+)
+
+// instrumentHandlerVars instruments the function literals of values assigned to lhs whose
+// variables are typed echo.HandlerFunc or http.HandlerFunc, like
+// `var handler echo.HandlerFunc = func(c echo.Context) error {...}`.
+func (in *instrumenter) instrumentHandlerVars(ctx context.Context, lhs, values []ast.Expr) error {
+	if len(lhs) != len(values) {
+		return nil
+	}
+	for i, v := range values {
+		lit, ok := v.(*ast.FuncLit)
+		if !ok {
+			continue
+		}
+		ident, ok := lhs[i].(*ast.Ident)
+		if !ok {
+			continue
+		}
+		obj := in.info.ObjectOf(ident)
+		if obj == nil {
+			continue
+		}
+		switch {
+		case isNamedType(obj.Type(), echoPkgPath, "HandlerFunc"):
+			if err := in.instrument(ctx, ident.Name, lit.Type, lit.Body, nil); err != nil {
+				return err
+			}
+		case isNamedType(obj.Type(), "net/http", "HandlerFunc"):
+			req := httpRequestParam(lit.Type)
+			if req == "" {
+				in.skip(lit.Pos(), ident.Name, skipWrongSignature, "*http.Request param is unnamed")
+				continue
+			}
+			ctxFrom := &ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: req}, Sel: &ast.Ident{Name: "Context"}}}
+			if err := in.insertSpan(ctx, ident.Name, lit.Type, lit.Body, nil, ctxFrom, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// httpRequestParam returns the name of the *http.Request param of an http.HandlerFunc literal.
+func httpRequestParam(ftype *ast.FuncType) string {
+	var names []string
+	for _, field := range ftype.Params.List {
+		for _, n := range field.Names {
+			names = append(names, n.Name)
+		}
+	}
+	if len(names) != 2 || names[1] == "_" {
+		return ""
+	}
+	return names[1]
+}
+
+func isNamedType(t types.Type, pkgPath, name string) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == pkgPath && obj.Name() == name
+}
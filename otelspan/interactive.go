@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// confirmer asks on stdin whether to apply each change for -interactive.
+type confirmer struct {
+	in  *bufio.Reader
+	out io.Writer
+	// declined answers no without asking, when stdin is not a terminal
+	declined bool
+}
+
+// newConfirmer returns a confirmer reading answers from r, or from os.Stdin if r is nil, in
+// which case every change is declined unless it is a terminal.
+func newConfirmer(ctx context.Context, r io.Reader) *confirmer {
+	if r == nil {
+		if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			slog.WarnContext(ctx, "stdin is not a terminal, declining every change")
+			return &confirmer{declined: true}
+		}
+		r = os.Stdin
+	}
+	return &confirmer{in: bufio.NewReader(r), out: os.Stderr}
+}
+
+// confirm prints the change, e.g. "main.go:12: instrument GetUser? [y/N] ", and reports whether
+// the answer is yes. The input running out is a no.
+func (c *confirmer) confirm(pos, name string) bool {
+	if c.declined {
+		return false
+	}
+	fmt.Fprintf(c.out, "%s: instrument %s? [y/N] ", pos, name)
+	answer, err := c.in.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(c.out)
+		c.declined = true
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
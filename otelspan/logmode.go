@@ -0,0 +1,80 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+)
+
+const (
+	modeSpan = "span"
+	// modeLog logs the duration of functions instead of starting spans, for apps without OpenTelemetry
+	modeLog = "log"
+)
+
+const defaultLogFunc = "log.Printf"
+
+// logFuncExpr returns the printf-like function logging durations.
+func (in *instrumenter) logFuncExpr() ast.Expr {
+	fun, _ := parser.ParseExpr(in.opts.logFunc())
+	return fun
+}
+
+func (o *Opts) logFunc() string {
+	if o.LogFunc == "" {
+		return defaultLogFunc
+	}
+	return o.LogFunc
+}
+
+// logImport returns the import path of the package of the log func, empty if it needs none.
+func (o *Opts) logImport() string {
+	if o.LogFunc == "" {
+		return "log"
+	}
+	return o.LogImport
+}
+
+// timingLogStmt returns the statement logging the duration of the function name when it returns:
+//
+//	defer func(start time.Time) {
+//		log.Printf("%s took %s", "name", time.Since(start))
+//	}(time.Now())
+func timingLogStmt(logFunc ast.Expr, timePkg, name string) ast.Stmt {
+	timeCall := func(fn string, args ...ast.Expr) ast.Expr {
+		return &ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: timePkg}, Sel: &ast.Ident{Name: fn}}, Args: args}
+	}
+	return &ast.DeferStmt{Call: &ast.CallExpr{
+		Fun: &ast.FuncLit{
+			Type: &ast.FuncType{Params: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{{Name: "start"}},
+				Type:  &ast.SelectorExpr{X: &ast.Ident{Name: timePkg}, Sel: &ast.Ident{Name: "Time"}},
+			}}}},
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				&ast.ExprStmt{X: &ast.CallExpr{
+					Fun: logFunc,
+					Args: []ast.Expr{
+						&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote("%s took %s")},
+						&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(name)},
+						timeCall("Since", &ast.Ident{Name: "start"}),
+					},
+				}},
+			}},
+		},
+		Args: []ast.Expr{timeCall("Now")},
+	}}
+}
+
+// isTimingLog reports whether stmt is the statement of timingLogStmt.
+func isTimingLog(stmt ast.Stmt) bool {
+	d, ok := stmt.(*ast.DeferStmt)
+	if !ok || len(d.Call.Args) != 1 {
+		return false
+	}
+	lit, ok := d.Call.Fun.(*ast.FuncLit)
+	if !ok || len(lit.Type.Params.List) != 1 || len(lit.Type.Params.List[0].Names) != 1 {
+		return false
+	}
+	return lit.Type.Params.List[0].Names[0].Name == "start"
+}
@@ -5,6 +5,8 @@ import (
 	"flag"
 	"log/slog"
 	"os"
+	"regexp"
+	"strings"
 )
 
 var logLevelMap = map[string]slog.Level{
@@ -14,20 +16,201 @@ var logLevelMap = map[string]slog.Level{
 	"error": slog.LevelError,
 }
 
+// defaultMaxNesting instruments the function literals of func decls, e.g. goroutines and
+// callbacks of handlers, but not the function literals nested in them.
+const defaultMaxNesting = 1
+
+// maxNestingFlags registers -max-nesting and its alias -max-closure-depth on fs, both setting
+// maxNesting with the same default, so that either name may be used.
+func maxNestingFlags(fs *flag.FlagSet, maxNesting *int) {
+	fs.IntVar(maxNesting, "max-nesting", defaultMaxNesting, "max depth of nested function literals to instrument; the default instruments function literals in func decls, which 0 stops, as before this flag")
+	fs.IntVar(maxNesting, "max-closure-depth", defaultMaxNesting, "alias of -max-nesting")
+}
+
 func main() {
 	ctx := context.Background()
 	var fix bool
 	var logLevelStr string
+	var verbose bool
+	var quiet bool
+	var interactive bool
+	var plan string
+	var maxNesting int
+	var outDir string
+	var includeTests string
+	var existingStart string
+	var tracerFunc string
+	var tracerImport string
+	var routeNames bool
+	var minimalDiff bool
+	var nolint string
+	var remove bool
+	var resync bool
+	var backup bool
+	var backupForce bool
+	var since string
+	var ctxExpr string
+	var printCandidates bool
+	var outputSuffix string
+	var excludeSources bool
+	var requireTracer bool
+	var checkCtx bool
+	var reachableFromRoutes bool
+	var goos string
+	var goarch string
+	var alsoInstrument string
+	var handlerVars bool
+	var maxFuncsPerFile int
+	var captureCtx bool
+	var propagateCtx bool
+	var wrapBody bool
+	var framework string
+	var strict bool
+	var companion bool
+	var coverageOut string
+	var reportUnusedHandlers bool
+	var routeAttr bool
+	var spanAfterParse bool
+	var statusFromResponse bool
+	var postFormat string
+	var mode string
+	var logFunc string
+	var logImport string
+	var attributeAlias string
+	var codesAlias string
 	flag.BoolVar(&fix, "fix", false, "fix the code")
 	flag.StringVar(&logLevelStr, "log-level", "info", "log level")
+	flag.BoolVar(&verbose, "v", false, "verbose output (same as -log-level debug)")
+	flag.BoolVar(&quiet, "quiet", false, "only log errors (same as -log-level error) and do not print the summary of -fix")
+	flag.BoolVar(&interactive, "interactive", false, "ask on stdin whether to instrument each function before writing (with -fix), declining all when stdin is not a terminal")
+	flag.StringVar(&plan, "plan", "", "print planned edits without writing files (json)")
+	maxNestingFlags(flag.CommandLine, &maxNesting)
+	flag.StringVar(&outDir, "out", "", "write fixed files under this directory instead of overwriting the sources")
+	flag.StringVar(&includeTests, "include-tests", "", "instrument test files whose name matches this pattern (test files are skipped by default)")
+	flag.StringVar(&existingStart, "existing-start", "", "regexp of span start calls (e.g. trace\\.StartSpan) marking a function as already instrumented")
+	flag.StringVar(&tracerFunc, "tracer-func", "", "start spans from a shared tracer func called with the package path (e.g. tracing.Tracer) instead of the package level tracer var")
+	flag.StringVar(&tracerImport, "tracer-import", "", "import path of the package providing -tracer-func")
+	flag.BoolVar(&routeNames, "route-names", false, "name spans of echo handlers after their route (e.g. GET /users/:id)")
+	flag.BoolVar(&routeAttr, "route-attr", false, "set the http.route attribute of spans of echo handlers to the path of their route, registered directly or from a route table")
+	flag.BoolVar(&spanAfterParse, "span-after-parse", false, "start the spans of echo and http handlers after their leading statements parsing the request, like c.Param and c.Bind, instead of at the top")
+	flag.BoolVar(&statusFromResponse, "status-from-response", false, "record the status echo handlers write with c.JSON, c.String, c.NoContent and the like on their spans, setting the error status for a 5xx")
+	flag.StringVar(&postFormat, "post-format", "", "formatter command the changed files are piped through before being written (e.g. gofumpt)")
+	flag.StringVar(&mode, "mode", modeSpan, "what to instrument functions with: span starts an otel span, log logs their duration with -log-func")
+	flag.StringVar(&logFunc, "log-func", "", "printf-like function -mode=log logs durations with (default log.Printf)")
+	flag.StringVar(&logImport, "log-import", "", "import path of the package providing -log-func")
+	flag.BoolVar(&minimalDiff, "minimal-diff", false, "only insert the span statements instead of reformatting the whole file")
+	flag.StringVar(&nolint, "nolint", "", "linters to disable on the inserted span start with a //nolint:<linters> comment")
+	flag.BoolVar(&remove, "remove", false, "remove spans added by otelspan (with -fix)")
+	flag.BoolVar(&resync, "resync", false, "remove spans added by otelspan and add them again with the current options (with -fix)")
+	flag.BoolVar(&backup, "backup", false, "copy each file to <file>.orig before overwriting it, unless the backup exists")
+	flag.BoolVar(&backupForce, "backup-force", false, "like -backup, but overwrite existing backups")
+	flag.StringVar(&since, "since", "", "only process go files changed since this git ref (e.g. origin/main)")
+	flag.StringVar(&ctxExpr, "ctx-expr", "", "template of the expression deriving ctx from the echo.Context param {{.Param}} (default {{.Param}}.Request().Context())")
+	flag.BoolVar(&printCandidates, "print-candidates", false, "list each function with whether it would be instrumented or why it is skipped, without modifying files")
+	flag.StringVar(&outputSuffix, "output-suffix", "", "write instrumented files to siblings with this suffix (e.g. _traced) built with -tags otelspan instead of overwriting the sources")
+	flag.BoolVar(&excludeSources, "exclude-sources", false, "add //go:build !otelspan to the sources of the files written by -output-suffix so that -tags otelspan builds only the instrumented ones")
+	flag.BoolVar(&requireTracer, "require-tracer", false, "fail listing packages that would be instrumented but have no package level tracer var, leaving their files untouched")
+	flag.BoolVar(&checkCtx, "check-ctx", false, "report calls after a span start that pass a ctx other than the span's, e.g. context.Background(), without modifying files")
+	flag.BoolVar(&reachableFromRoutes, "reachable-from-routes", false, "only instrument functions reachable from echo route handlers in the call graph")
+	flag.StringVar(&goos, "goos", "", "comma separated GOOS values to load packages for in turn (e.g. linux,windows)")
+	flag.StringVar(&goarch, "goarch", "", "comma separated GOARCH values to load packages for in turn, combined with each -goos")
+	flag.StringVar(&alsoInstrument, "also-instrument", "", "comma separated module paths to instrument too although they are outside the dir (e.g. vendored modules you own)")
+	flag.BoolVar(&handlerVars, "handler-vars", false, "instrument function literals assigned to echo.HandlerFunc or http.HandlerFunc variables, naming spans after the variables")
+	flag.IntVar(&maxFuncsPerFile, "max-funcs-per-file", 0, "skip with a warning files declaring more functions than this, which are likely generated (0 = no limit)")
+	flag.BoolVar(&captureCtx, "capture-ctx", false, "start spans as ctx, span := tracer.Start(ctx, ...) in functions passing ctx to calls after it, instead of discarding the span's ctx")
+	flag.BoolVar(&propagateCtx, "propagate-ctx", false, "start every span as ctx, span := tracer.Start(ctx, ...) so that the rest of the body uses the span's ctx")
+	flag.BoolVar(&wrapBody, "wrap-body", false, "wrap the body of functions returning only an error in a func literal to record the returned error on the span (not removable by -remove)")
+	flag.StringVar(&framework, "framework", "", "web framework of the handlers (echo), warning when no processed file imports it")
+	flag.BoolVar(&strict, "strict", false, "fail instead of warning when no processed file imports the -framework")
+	flag.BoolVar(&companion, "companion", false, "write wrappers starting spans, e.g. tracedGetUser calling GetUser, to a <file>_otel.go file per source instead of modifying the sources")
+	flag.StringVar(&coverageOut, "coverage-out", "", "write a JSON summary of whether each ctx and handler function is traced to this file (e.g. coverage.json)")
+	flag.BoolVar(&reportUnusedHandlers, "report-unused-handlers", false, "report exported echo handlers not registered to any route, without modifying files")
+	flag.StringVar(&attributeAlias, "attribute-alias", "attribute", "name generated code imports go.opentelemetry.io/otel/attribute as")
+	flag.StringVar(&codesAlias, "codes-alias", "codes", "name generated code imports go.opentelemetry.io/otel/codes as")
 	flag.Parse()
 
 	logLevel, ok := logLevelMap[logLevelStr]
 	if !ok {
 		logLevel = slog.LevelInfo
 	}
-	if err := Run(ctx, "./", &Opts{Fix: fix, LogLevel: logLevel}); err != nil {
+	switch {
+	case verbose:
+		logLevel = slog.LevelDebug
+	case quiet:
+		logLevel = slog.LevelError
+	}
+	opts := &Opts{
+		Fix:                  fix,
+		LogLevel:             logLevel,
+		Plan:                 plan,
+		MaxNesting:           maxNesting,
+		OutDir:               outDir,
+		IncludeTests:         includeTests,
+		TracerFunc:           tracerFunc,
+		TracerImport:         tracerImport,
+		RouteNames:           routeNames,
+		MinimalDiff:          minimalDiff,
+		Nolint:               nolint,
+		Remove:               remove,
+		Resync:               resync,
+		Backup:               backup,
+		BackupForce:          backupForce,
+		Since:                since,
+		CtxExpr:              ctxExpr,
+		PrintCandidates:      printCandidates,
+		OutputSuffix:         outputSuffix,
+		ExcludeSources:       excludeSources,
+		RequireTracer:        requireTracer,
+		CheckCtx:             checkCtx,
+		ReachableFromRoutes:  reachableFromRoutes,
+		GOOS:                 splitList(goos),
+		GOARCH:               splitList(goarch),
+		AlsoInstrument:       splitList(alsoInstrument),
+		HandlerVars:          handlerVars,
+		MaxFuncsPerFile:      maxFuncsPerFile,
+		CaptureCtx:           captureCtx,
+		PropagateCtx:         propagateCtx,
+		WrapBody:             wrapBody,
+		Framework:            framework,
+		Strict:               strict,
+		Companion:            companion,
+		CoverageOut:          coverageOut,
+		Quiet:                quiet,
+		Interactive:          interactive,
+		StatusFromResponse:   statusFromResponse,
+		PostFormat:           postFormat,
+		Mode:                 mode,
+		LogFunc:              logFunc,
+		LogImport:            logImport,
+		ReportUnusedHandlers: reportUnusedHandlers,
+		RouteAttr:            routeAttr,
+		SpanAfterParse:       spanAfterParse,
+		Aliases: map[string]string{
+			attributePkgPath: attributeAlias,
+			codesPkgPath:     codesAlias,
+		},
+	}
+	if existingStart != "" {
+		re, err := regexp.Compile(existingStart)
+		if err != nil {
+			slog.ErrorContext(ctx, "invalid existing-start", slog.Any("error", err))
+			os.Exit(1)
+		}
+		opts.ExistingStart = re
+	}
+	from := "./"
+	if flag.NArg() > 0 {
+		from = flag.Arg(0)
+	}
+	if err := Run(ctx, from, opts); err != nil {
 		slog.ErrorContext(ctx, "error occurred", slog.Any("error", err))
 		os.Exit(1)
 	}
 }
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -1,147 +1,1411 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/json"
 	"fmt"
 	"go/ast"
 	"go/format"
+	"go/parser"
+	"go/printer"
 	"go/token"
+	"go/types"
+	"io"
 	"log/slog"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/samber/lo"
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
 )
 
+const (
+	attributePkgPath = "go.opentelemetry.io/otel/attribute"
+	codesPkgPath     = "go.opentelemetry.io/otel/codes"
+)
+
+// frameworkPkgPaths maps the supported frameworks to their import paths.
+var frameworkPkgPaths = map[string]string{
+	"echo": echoPkgPath,
+}
+
 type Opts struct {
-	Fix      bool
-	LogLevel slog.Level
+	Fix             bool
+	LogLevel        slog.Level
+	Plan            string
+	MaxNesting      int
+	OutDir          string
+	IncludeTests    string
+	ExistingStart   *regexp.Regexp
+	TracerFunc      string
+	TracerImport    string
+	RouteNames      bool
+	MinimalDiff     bool
+	Nolint          string
+	Remove          bool
+	Resync          bool
+	Backup          bool
+	BackupForce     bool
+	Since           string
+	PrintCandidates bool
+	// CheckCtx reports calls passing a ctx other than the one of the span started before them instead of instrumenting
+	CheckCtx bool
+	// RequireTracer reports packages that would be instrumented but have no tracer var, without writing them
+	RequireTracer bool
+	// GOOS and GOARCH are the targets to load packages for in turn, so that files of every
+	// target are instrumented; empty means the host's
+	GOOS   []string
+	GOARCH []string
+	// ReachableFromRoutes limits instrumentation to functions reachable from echo route handlers
+	ReachableFromRoutes bool
+	// OutputSuffix makes -fix write instrumented files to siblings with the suffix, e.g. foo_traced.go
+	OutputSuffix string
+	// ExcludeSources adds //go:build !otelspan to the sources of the files written with OutputSuffix,
+	// which otherwise stay untouched and conflict with them when built with -tags otelspan
+	ExcludeSources bool
+	// CtxExpr is a text/template of the expression deriving ctx from the echo.Context param
+	// named {{.Param}}, e.g. mw.CtxFrom({{.Param}})
+	CtxExpr string
+	// AlsoInstrument lists module paths whose packages are instrumented too although they are
+	// outside the dir, e.g. vendored modules the repository owns
+	AlsoInstrument []string
+	// HandlerVars instruments function literals assigned to echo.HandlerFunc or http.HandlerFunc
+	// typed variables, naming their spans after the variables
+	HandlerVars bool
+	// MaxFuncsPerFile skips files declaring more functions, which are likely generated; 0 means no limit
+	MaxFuncsPerFile int
+	// CaptureCtx starts spans as `ctx, span := tracer.Start(ctx, name)` in functions passing ctx to
+	// a call after the span start, so that the callees are in the span, and as `_, span :=` otherwise
+	CaptureCtx bool
+	// WrapBody moves the body of functions returning only an error into a func literal called
+	// after the span start, recording the error it returns on the span whichever return fires
+	WrapBody bool
+	// Framework is the web framework whose handlers are expected; when set, a run processing no
+	// file importing it is warned about, or fails with Strict
+	Framework string
+	Strict    bool
+	// Companion writes a wrapper starting a span for each function that would be instrumented,
+	// e.g. tracedGetUser calling GetUser, to a foo_otel.go file per source instead of modifying it
+	Companion bool
+	// PropagateCtx starts every span as `ctx, span := tracer.Start(ctx, name)`
+	PropagateCtx bool
+	// RouteAttr sets the http.route attribute of spans of handlers to the path of their route
+	RouteAttr bool
+	// SpanAfterParse starts the spans of handlers after their leading statements parsing the
+	// request args, like c.Param and c.Bind, instead of at the top
+	SpanAfterParse bool
+	// ReportUnusedHandlers reports exported echo handlers not registered to any route instead of instrumenting
+	ReportUnusedHandlers bool
+	// StatusFromResponse records the status of the response echo handlers write with c.JSON and
+	// the like on their spans, setting the error status for a 5xx
+	StatusFromResponse bool
+	// Mode is what functions are instrumented with: modeSpan, the default, or modeLog
+	Mode string
+	// LogFunc is the printf-like function, e.g. log.Printf, modeLog logs durations with, imported from LogImport
+	LogFunc   string
+	LogImport string
+	// PostFormat is a formatter command, e.g. gofumpt, the changed files are piped through before being written
+	PostFormat string
+	// Interactive asks on Stdin whether to instrument each function before Fix writes it; if Stdin
+	// is nil, os.Stdin is read when it is a terminal and every function is declined otherwise
+	Interactive bool
+	Stdin       io.Reader
+	// Quiet suppresses the summary printed by Fix
+	Quiet bool
+	// CoverageOut writes the Coverage of the ctx and handler functions to this file, with or without Fix
+	CoverageOut string
+	// Aliases maps import paths of packages used by generated code to the names to import them as
+	Aliases map[string]string
+}
+
+// pkgName returns the name generated code refers to the package at importPath by.
+func (o *Opts) pkgName(importPath string) string {
+	if name := o.Aliases[importPath]; name != "" {
+		return name
+	}
+	return path.Base(importPath)
+}
+
+// ctxExpr returns the expression deriving ctx from the echo.Context param.
+func (o *Opts) ctxExpr(param string) (ast.Expr, error) {
+	if o.CtxExpr == "" {
+		return echoCtxExpr(param), nil
+	}
+	tmpl, err := template.New("ctx-expr").Option("missingkey=error").Parse(o.CtxExpr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ctx-expr: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, struct{ Param string }{Param: param}); err != nil {
+		return nil, fmt.Errorf("invalid ctx-expr: %w", err)
+	}
+	expr, err := parser.ParseExpr(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid ctx-expr: %s: %w", b.String(), err)
+	}
+	return expr, nil
+}
+
+// fileImports maps the paths imported by f to the names f refers to them by.
+func fileImports(f *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, spec := range f.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			if spec.Name.Name == "_" || spec.Name.Name == "." {
+				continue
+			}
+			name = spec.Name.Name
+		}
+		imports[importPath] = name
+	}
+	return imports
 }
 
+// importSpecName returns the explicit name f imports importPath as, if any.
+func importSpecName(f *ast.File, importPath string) string {
+	for _, spec := range f.Imports {
+		if p, _ := strconv.Unquote(spec.Path.Value); p == importPath && spec.Name != nil {
+			return spec.Name.Name
+		}
+	}
+	return ""
+}
+
+// pkgName returns the name the current file refers to the package at importPath by: the one it
+// already imports it as, or else the one from opts.Aliases.
+func (in *instrumenter) pkgName(importPath string) string {
+	if name, ok := in.imports[importPath]; ok {
+		return name
+	}
+	return in.opts.pkgName(importPath)
+}
+
+// addImport imports importPath under the name from opts.Aliases, reporting whether it was added.
+func (o *Opts) addImport(fset *token.FileSet, f *ast.File, importPath string) bool {
+	var name string
+	if n := o.pkgName(importPath); n != path.Base(importPath) {
+		name = n
+	}
+	return astutil.AddNamedImport(fset, f, name, importPath)
+}
+
+// loadMode is what Run loads of the packages.
+var loadMode = packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedImports | packages.NeedTypesInfo | packages.NeedName | packages.NeedModule
+
 func Run(ctx context.Context, from string, opts *Opts) error {
 	dir, err := filepath.Abs(from)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: opts.LogLevel}))
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: opts.LogLevel}))
 	slog.SetDefault(logger)
 	slog.DebugContext(ctx, "dir", slog.String("dir", dir))
-	pkgs, err := packages.Load(&packages.Config{
-		Mode: packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedImports | packages.NeedTypesInfo | packages.NeedName | packages.NeedModule,
-		Dir:  dir,
-	}, dir)
-	if err != nil {
-		return fmt.Errorf("failed to load package: %w", err)
+	switch opts.Mode {
+	case "", modeSpan:
+	case modeLog:
+		if opts.Remove || opts.Resync || opts.Companion || opts.WrapBody || opts.StatusFromResponse || opts.CaptureCtx || opts.PropagateCtx || opts.RouteAttr || opts.SpanAfterParse || opts.RequireTracer || opts.TracerFunc != "" {
+			return fmt.Errorf("mode=log cannot be combined with remove, resync, companion, wrap-body, status-from-response, capture-ctx, propagate-ctx, route-attr, span-after-parse, require-tracer or tracer-func")
+		}
+		fun, err := parser.ParseExpr(opts.logFunc())
+		if err != nil {
+			return fmt.Errorf("invalid log-func: %w", err)
+		}
+		switch fun.(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+		default:
+			return fmt.Errorf("invalid log-func: must be a function name like log.Printf: %s", opts.LogFunc)
+		}
+	default:
+		return fmt.Errorf("unknown mode: %s", opts.Mode)
+	}
+	if opts.TracerFunc != "" {
+		fun, err := parser.ParseExpr(opts.TracerFunc)
+		if err != nil {
+			return fmt.Errorf("invalid tracer-func: %w", err)
+		}
+		switch fun.(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+		default:
+			return fmt.Errorf("invalid tracer-func: must be a function name like tracing.Tracer: %s", opts.TracerFunc)
+		}
+	}
+	if _, err := opts.ctxExpr("c"); err != nil {
+		return err
+	}
+	if _, ok := frameworkPkgPaths[opts.Framework]; opts.Framework != "" && !ok {
+		return fmt.Errorf("unsupported framework: %s", opts.Framework)
+	}
+	if opts.Companion && (opts.MinimalDiff || opts.Plan != "" || opts.OutDir != "" || opts.OutputSuffix != "" || opts.Remove || opts.Resync) {
+		return fmt.Errorf("companion cannot be combined with minimal-diff, plan, out, output-suffix, remove or resync")
+	}
+	if opts.WrapBody && (opts.MinimalDiff || opts.Plan != "") {
+		return fmt.Errorf("wrap-body cannot be combined with minimal-diff or plan")
+	}
+	if (opts.Remove || opts.Resync) && (opts.MinimalDiff || opts.Plan != "") {
+		return fmt.Errorf("remove and resync cannot be combined with minimal-diff or plan")
+	}
+	if opts.OutputSuffix != "" && (opts.OutDir != "" || opts.Remove || opts.Resync) {
+		return fmt.Errorf("output-suffix cannot be combined with out, remove or resync")
+	}
+	if opts.ExcludeSources && opts.OutputSuffix == "" {
+		return fmt.Errorf("exclude-sources requires output-suffix")
+	}
+	if len(opts.AlsoInstrument) > 0 && opts.OutDir != "" {
+		return fmt.Errorf("also-instrument cannot be combined with out")
+	}
+	if opts.PostFormat != "" {
+		// fail before writing any file
+		args := strings.Fields(opts.PostFormat)
+		if len(args) == 0 {
+			return fmt.Errorf("invalid post-format: empty command")
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			return fmt.Errorf("invalid post-format: %w", err)
+		}
+	}
+	if opts.Interactive && (!opts.Fix || opts.Plan != "" || opts.PrintCandidates || opts.Remove || opts.Resync) {
+		return fmt.Errorf("interactive requires fix and cannot be combined with plan, print-candidates, remove or resync")
+	}
+	if opts.IncludeTests != "" {
+		if _, err := filepath.Match(opts.IncludeTests, ""); err != nil {
+			return fmt.Errorf("invalid include-tests pattern: %w", err)
+		}
+	}
+	var modCache string
+	if len(opts.AlsoInstrument) > 0 && opts.Fix {
+		if modCache, err = moduleCacheDir(ctx, dir); err != nil {
+			return err
+		}
+	}
+	var changed map[string]bool
+	if opts.Since != "" {
+		changed, err = changedFiles(ctx, dir, opts.Since)
+		if err != nil {
+			return err
+		}
 	}
-	pkgs = lo.Filter(pkgs, func(pkg *packages.Package, _ int) bool {
-		return strings.HasPrefix(pkg.Module.Dir, dir)
-	})
 
-	for _, pkg := range pkgs {
-		slog.DebugContext(ctx, "pkg", slog.String("path", pkg.PkgPath))
-		for _, f := range pkg.Syntax {
-			astutil.Apply(f, nil, func(c *astutil.Cursor) bool {
-				n := c.Node()
-				switch x := n.(type) {
-				case *ast.FuncDecl:
-					echoVar := false
-					if list := x.Type.Params.List; len(list) > 0 {
-						estimateCtx := list[0]
-						switch estimateCtx.Names[0].Name {
-						case "c":
-							t, ok := estimateCtx.Type.(*ast.SelectorExpr)
-							if !ok {
-								return true
-							}
-							if n, ok := t.X.(*ast.Ident); ok && n.Name == "echo" && t.Sel.Name == "Context" {
-								echoVar = true
-							} else {
-								return true
-							}
-						case "ctx":
-							t, ok := estimateCtx.Type.(*ast.SelectorExpr)
-							if !ok {
-								return true
-							}
-							if n, ok := t.X.(*ast.Ident); ok && n.Name == "context" && t.Sel.Name == "Context" {
-								// pass
-							} else {
-								return true
-							}
-						default:
-							return true
-						}
-					} else {
-						return true
-					}
-					if x.Doc != nil {
-						for _, docc := range x.Doc.List {
-							if docc.Text == "//elephandog:ignore-trace" {
-								return true
-							}
-							if docc.Text == "//elephandog:append-trace" {
-								return true
-							}
+	in := &instrumenter{opts: opts, skips: map[skipReason]int{}}
+	if opts.Interactive {
+		in.confirmer = newConfirmer(ctx, opts.Stdin)
+	}
+	var missingTracerPkgs []string
+	frameworkImported := false
+	var findings []string
+	var unused []string
+	// files shared by several targets are processed with the first one
+	seen := map[string]bool{}
+	for _, target := range buildTargets(opts.GOOS, opts.GOARCH) {
+		slog.DebugContext(ctx, "target", slog.String("goos", target.goos), slog.String("goarch", target.goarch))
+		mode := loadMode
+		if opts.ReachableFromRoutes {
+			// the call graph is built from the types of the dependencies too
+			mode |= packages.NeedDeps
+		}
+		pkgs, err := packages.Load(&packages.Config{
+			Mode:  mode,
+			Dir:   dir,
+			Env:   target.env(),
+			Tests: opts.IncludeTests != "",
+		}, append([]string{dir}, lo.Map(opts.AlsoInstrument, func(m string, _ int) string {
+			return m + "/..."
+		})...)...)
+		if err != nil {
+			return fmt.Errorf("failed to load package: %w", err)
+		}
+		loaded := len(pkgs)
+		// Module is nil for packages outside a module, e.g. with GO111MODULE=off
+		pkgs = lo.Filter(pkgs, func(pkg *packages.Package, _ int) bool {
+			return pkg.Module != nil && (strings.HasPrefix(pkg.Module.Dir, dir) || slices.Contains(opts.AlsoInstrument, pkg.Module.Path))
+		})
+		if len(pkgs) == 0 {
+			if loaded == 0 {
+				return fmt.Errorf("no packages found in %s", dir)
+			}
+			return fmt.Errorf("none of the %d packages loaded from %s belongs to a module rooted under it: run otelspan in the directory of the go.mod or above it", loaded, dir)
+		}
+		if modCache != "" {
+			// fail before writing any file
+			for _, pkg := range pkgs {
+				if inDir(pkg.Module.Dir, modCache) {
+					return fmt.Errorf("also-instrument: module %s is in the read-only module cache at %s: vendor it or replace it with a local copy to instrument it", pkg.Module.Path, pkg.Module.Dir)
+				}
+			}
+		}
+
+		if opts.RouteNames || opts.RouteAttr || opts.ReachableFromRoutes || opts.ReportUnusedHandlers {
+			in.routes = collectRoutes(pkgs)
+		}
+		if opts.ReportUnusedHandlers {
+			unused = append(unused, unusedHandlers(pkgs, in.routes)...)
+			continue
+		}
+		if opts.ReachableFromRoutes {
+			in.reachable = reachableFuncs(pkgs, in.routes)
+		}
+		for _, pkg := range pkgs {
+			slog.DebugContext(ctx, "pkg", slog.String("path", pkg.PkgPath))
+			in.fset = pkg.Fset
+			in.pkgPath = pkg.PkgPath
+			in.info = pkg.TypesInfo
+			in.contextIface = lookupContextIface(pkg.Types)
+			if packageDisabled(pkg.Syntax) {
+				slog.DebugContext(ctx, "package disabled", slog.String("path", pkg.PkgPath))
+				for _, f := range pkg.Syntax {
+					if filename := pkg.Fset.Position(f.Pos()).Filename; !seen[filename] {
+						seen[filename] = true
+						in.skipFile(f, skipDisabledPackage, "package disabled by "+disableDirective)
+					}
+				}
+				continue
+			}
+			// the generated code refers to a package level tracer var unless tracer-func is set
+			missingTracer := opts.RequireTracer && opts.TracerFunc == "" && pkg.Types.Scope().Lookup("tracer") == nil
+			for _, f := range pkg.Syntax {
+				// with test variants loaded, the same file can appear in several packages
+				filename := pkg.Fset.Position(f.Pos()).Filename
+				if seen[filename] {
+					continue
+				}
+				seen[filename] = true
+				if changed != nil && !changed[filename] {
+					in.skipFile(f, skipExcludedPath, "not changed since "+opts.Since)
+					continue
+				}
+				if opts.Companion && strings.HasSuffix(filename, companionSuffix) {
+					// wrappers generated before
+					continue
+				}
+				if strings.HasSuffix(filename, "_test.go") {
+					if ok, _ := filepath.Match(opts.IncludeTests, filepath.Base(filename)); !ok {
+						in.skipFile(f, skipTestFile, "test file")
+						continue
+					}
+				}
+				if opts.MaxFuncsPerFile > 0 {
+					if n := lo.CountBy(f.Decls, func(decl ast.Decl) bool {
+						_, ok := decl.(*ast.FuncDecl)
+						return ok
+					}); n > opts.MaxFuncsPerFile {
+						slog.WarnContext(ctx, "skipping file with too many functions, likely generated", slog.String("filename", filename), slog.Int("funcs", n))
+						in.skipFile(f, skipTooManyFuncs, "file has more than max-funcs-per-file functions")
+						continue
+					}
+				}
+				if opts.CheckCtx {
+					findings = append(findings, checkCtxPropagation(pkg.Fset, pkg.TypesInfo, f)...)
+					continue
+				}
+				in.modified = false
+				in.needsAttribute = false
+				in.needsCodes = false
+				in.needsTime = false
+				in.edits = nil
+				in.nolintStarts = nil
+				if opts.Plan != "" || opts.MinimalDiff {
+					src, err := os.ReadFile(filename)
+					if err != nil {
+						return fmt.Errorf("failed to read file: %w", err)
+					}
+					in.src = src
+				}
+				importsFrom, importsTo := importDeclsRange(f)
+				removed := 0
+				if opts.Remove || opts.Resync {
+					removed = removeSpans(ctx, pkg.Fset, f)
+					for _, importPath := range []string{attributePkgPath, codesPkgPath} {
+						if removed > 0 && !astutil.UsesImport(f, importPath) {
+							astutil.DeleteNamedImport(pkg.Fset, f, importSpecName(f, importPath), importPath)
 						}
 					}
-					slog.DebugContext(ctx, "func", slog.String("name", x.Name.Name))
-					if echoVar {
-						for i, stmt := range x.Body.List {
-							if astmt, ok := stmt.(*ast.AssignStmt); ok {
-								ident := astmt.Lhs[0]
-								if ident.(*ast.Ident).Name == "ctx" {
-									x.Body.List = append(
-										x.Body.List[:i+1],
-										append(tracerStmts(x.Name.Name), x.Body.List[i+1:]...)...,
-									)
-									return true
-								}
-								return true
-							}
+					in.deletions += removed
+				}
+				in.imports = fileImports(f)
+				if _, ok := in.imports[frameworkPkgPaths[opts.Framework]]; ok {
+					frameworkImported = true
+				}
+				if opts.Companion {
+					written, err := in.writeCompanion(ctx, f, filename)
+					if err != nil {
+						return err
+					}
+					if written {
+						in.filesChanged++
+					}
+					continue
+				}
+				var instrumentErr error
+				astutil.Apply(f, nil, func(c *astutil.Cursor) bool {
+					if opts.Remove && !opts.Resync {
+						// only removing
+						return false
+					}
+					var err error
+					switch x := c.Node().(type) {
+					case *ast.FuncDecl:
+						err = in.instrumentDecl(ctx, x)
+					case *ast.ValueSpec:
+						if opts.HandlerVars {
+							err = in.instrumentHandlerVars(ctx, lo.Map(x.Names, func(n *ast.Ident, _ int) ast.Expr { return n }), x.Values)
 						}
-						x.Body.List = append(
-							echoCtxAssignStmt(),
-							append(tracerStmts(x.Name.Name), x.Body.List...)...,
-						)
-					} else {
-						x.Body.List = append(
-							tracerStmts(x.Name.Name),
-							x.Body.List...,
-						)
-					}
-					c.Replace(x)
-				}
-				return true
-			})
-			if !opts.Fix {
-				continue
+					case *ast.AssignStmt:
+						if opts.HandlerVars {
+							err = in.instrumentHandlerVars(ctx, x.Lhs, x.Rhs)
+						}
+					}
+					if err != nil {
+						instrumentErr = err
+						return false
+					}
+					return true
+				})
+				if instrumentErr != nil {
+					return instrumentErr
+				}
+				importAdded := false
+				if in.modified && opts.TracerImport != "" {
+					importAdded = addTracerImport(pkg.Fset, f, opts.TracerFunc, opts.TracerImport)
+				}
+				if _, imported := in.imports[attributePkgPath]; in.needsAttribute && !imported && opts.addImport(pkg.Fset, f, attributePkgPath) {
+					importAdded = true
+				}
+				if _, imported := in.imports[codesPkgPath]; in.needsCodes && !imported && opts.addImport(pkg.Fset, f, codesPkgPath) {
+					importAdded = true
+				}
+				if _, imported := in.imports["time"]; in.needsTime && !imported && astutil.AddImport(pkg.Fset, f, "time") {
+					importAdded = true
+				}
+				if in.needsTime && opts.logImport() != "" && addTracerImport(pkg.Fset, f, opts.logFunc(), opts.logImport()) {
+					importAdded = true
+				}
+				if opts.Plan != "" && importAdded {
+					edit, err := importEdit(pkg.Fset, f, importsFrom, importsTo)
+					if err != nil {
+						return err
+					}
+					in.plans = append(in.plans, &FuncPlan{Filename: filename, Edits: []TextEdit{edit}})
+				}
+				if in.modified || removed > 0 {
+					in.filesChanged++
+				}
+				if missingTracer && in.modified {
+					if !slices.Contains(missingTracerPkgs, pkg.PkgPath) {
+						missingTracerPkgs = append(missingTracerPkgs, pkg.PkgPath)
+					}
+					continue
+				}
+				if !opts.Fix || opts.Plan != "" || opts.PrintCandidates {
+					continue
+				}
+				target := filename
+				flag := os.O_WRONLY | os.O_TRUNC
+				if opts.OutDir != "" {
+					rel, err := filepath.Rel(dir, filename)
+					if err != nil {
+						return fmt.Errorf("failed to get relative path: %w", err)
+					}
+					target = filepath.Join(opts.OutDir, rel)
+					if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+						return fmt.Errorf("failed to create output directory: %w", err)
+					}
+					flag |= os.O_CREATE
+				} else if (opts.Backup || opts.BackupForce) && opts.OutputSuffix == "" && (in.modified || removed > 0) {
+					if err := backupFile(ctx, target, opts.BackupForce); err != nil {
+						return err
+					}
+				}
+				var content bytes.Buffer
+				if opts.MinimalDiff && !importAdded {
+					content.Write(applyEdits(in.src, in.edits))
+				} else {
+					if opts.MinimalDiff {
+						slog.WarnContext(ctx, "import added, formatting the whole file", slog.String("filename", filename))
+					}
+					if err := format.Node(&content, pkg.Fset, f); err != nil {
+						return fmt.Errorf("failed to format node: %w", err)
+					}
+					commented := in.withNolint(content.Bytes())
+					content.Reset()
+					content.Write(commented)
+				}
+				if opts.PostFormat != "" && (in.modified || removed > 0) {
+					formatted, err := postFormat(ctx, opts.PostFormat, filename, content.Bytes())
+					if err != nil {
+						return err
+					}
+					content.Reset()
+					content.Write(formatted)
+				}
+				if opts.OutputSuffix != "" {
+					if !in.modified {
+						continue
+					}
+					if err := writeGenerated(ctx, target, opts.OutputSuffix, content.Bytes(), opts.ExcludeSources); err != nil {
+						return err
+					}
+					continue
+				}
+				out, err := os.OpenFile(target, flag, 0o644)
+				if err != nil {
+					return fmt.Errorf("failed to create file: %w", err)
+				}
+				_, err = out.Write(content.Bytes())
+				out.Close()
+				if err != nil {
+					return fmt.Errorf("failed to write file: %w", err)
+				}
 			}
-			pos := pkg.Fset.Position(f.Pos())
-			fullFilename := pos.Filename
-			filename := strings.TrimPrefix(fullFilename, dir+"/")
-			out, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC, 0o644)
-			if err != nil {
-				return fmt.Errorf("failed to create file: %w", err)
+		}
+	}
+
+	if opts.CheckCtx {
+		for _, finding := range findings {
+			fmt.Println(finding)
+		}
+		if len(findings) > 0 {
+			return fmt.Errorf("%d calls do not pass the ctx of the span", len(findings))
+		}
+		return nil
+	}
+
+	if opts.ReportUnusedHandlers {
+		// handlers in files shared by several targets are found with each
+		unused = lo.Uniq(unused)
+		for _, finding := range unused {
+			fmt.Println(finding)
+		}
+		if len(unused) > 0 {
+			return fmt.Errorf("%d handlers are not registered to any route", len(unused))
+		}
+		return nil
+	}
+
+	if opts.Framework != "" && !frameworkImported {
+		err := fmt.Errorf("no processed file imports %s of framework %s, so no handler is instrumented as one", frameworkPkgPaths[opts.Framework], opts.Framework)
+		if opts.Strict {
+			return err
+		}
+		slog.WarnContext(ctx, err.Error())
+	}
+	if len(missingTracerPkgs) > 0 {
+		return fmt.Errorf("packages have no tracer var: %s", strings.Join(missingTracerPkgs, ", "))
+	}
+
+	if opts.CoverageOut != "" {
+		if err := writeCoverage(opts.CoverageOut, dir, in.covered); err != nil {
+			return err
+		}
+	}
+
+	if opts.PrintCandidates {
+		// function literals are classified before their enclosing functions
+		slices.SortStableFunc(in.candidates, func(a, b *Candidate) int {
+			return cmp.Or(cmp.Compare(a.pos.Filename, b.pos.Filename), cmp.Compare(a.pos.Offset, b.pos.Offset))
+		})
+		for _, c := range in.candidates {
+			fmt.Printf("%s\t%s\t%s\n", c.Pos, c.Func, c.Class)
+		}
+		return nil
+	}
+
+	switch opts.Plan {
+	case "":
+		if opts.Fix && !opts.Quiet {
+			fmt.Println(diffStat(in.filesChanged, in.insertions, in.deletions))
+			if summary := skipSummary(in.skips); summary != "" {
+				fmt.Println(summary)
 			}
-			if err := func() error {
-				defer out.Close()
-				if err := format.Node(out, pkg.Fset, f); err != nil {
-					return fmt.Errorf("failed to format node: %w", err)
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(in.plans); err != nil {
+			return fmt.Errorf("failed to encode plan: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown plan format: %s", opts.Plan)
+	}
+
+	return nil
+}
+
+type instrumenter struct {
+	fset       *token.FileSet
+	info       *types.Info
+	pkgPath    string
+	opts       *Opts
+	routes     map[string]string
+	reachable  map[string]bool
+	plans      []*FuncPlan
+	candidates []*Candidate
+	covered    []*CoveredFunc
+	confirmer  *confirmer
+
+	// context.Context as seen by the package, nil if it does not refer to it
+	contextIface *types.Interface
+
+	// totals of the run, counting statements
+	filesChanged int
+	insertions   int
+	deletions    int
+	skips        map[skipReason]int
+
+	// state of the file being instrumented
+	modified       bool
+	needsAttribute bool
+	needsCodes     bool
+	needsTime      bool
+	imports        map[string]string
+	src            []byte
+	edits          []TextEdit
+	// nolintStarts are the printed span starts of the file to comment with -nolint
+	nolintStarts []string
+}
+
+// Candidate is a function listed by -print-candidates with how it is classified.
+type Candidate struct {
+	Pos   string
+	Func  string
+	Class string
+	pos   token.Position
+}
+
+// skipReason tells why a function is not instrumented, counted in the summary of -fix.
+type skipReason int
+
+const (
+	skipNoBody skipReason = iota
+	skipIgnoreDirective
+	skipWrongSignature
+	skipAlreadyInstrumented
+	skipUnreachable
+	skipExcludedPath
+	skipTestFile
+	skipDisabledPackage
+	skipTooManyFuncs
+	skipDeclined
+)
+
+func (r skipReason) String() string {
+	switch r {
+	case skipNoBody:
+		return "no-body"
+	case skipIgnoreDirective:
+		return "ignore-directive"
+	case skipWrongSignature:
+		return "wrong-signature"
+	case skipAlreadyInstrumented:
+		return "already-instrumented"
+	case skipUnreachable:
+		return "unreachable"
+	case skipExcludedPath:
+		return "excluded-path"
+	case skipTestFile:
+		return "test-file"
+	case skipDisabledPackage:
+		return "disabled-package"
+	case skipTooManyFuncs:
+		return "too-many-funcs"
+	case skipDeclined:
+		return "declined"
+	}
+	return fmt.Sprintf("skipReason(%d)", int(r))
+}
+
+// skip counts a function skipped for reason, classifying it with detail for -print-candidates.
+func (in *instrumenter) skip(pos token.Pos, name string, reason skipReason, detail string) {
+	in.skips[reason]++
+	in.classify(pos, name, "skip: "+detail)
+}
+
+// skipFile skips the functions declared in f for reason.
+func (in *instrumenter) skipFile(f *ast.File, reason skipReason, detail string) {
+	for _, decl := range f.Decls {
+		if x, ok := decl.(*ast.FuncDecl); ok {
+			in.skip(x.Pos(), x.Name.Name, reason, detail)
+		}
+	}
+}
+
+// skipSummary breaks the skipped functions down by reason, e.g.
+// "12 functions skipped: 3 ignore-directive, 9 wrong-signature", or returns "" if none is.
+func skipSummary(skips map[skipReason]int) string {
+	reasons := lo.Keys(skips)
+	slices.Sort(reasons)
+	total := lo.Sum(lo.Values(skips))
+	if total == 0 {
+		return ""
+	}
+	counts := lo.Map(reasons, func(r skipReason, _ int) string {
+		return fmt.Sprintf("%d %s", skips[r], r)
+	})
+	if total == 1 {
+		return "1 function skipped: " + counts[0]
+	}
+	return fmt.Sprintf("%d functions skipped: %s", total, strings.Join(counts, ", "))
+}
+
+// classify records the classification of a function for -print-candidates.
+func (in *instrumenter) classify(pos token.Pos, name, class string) {
+	if !in.opts.PrintCandidates {
+		return
+	}
+	in.candidates = append(in.candidates, &Candidate{
+		Pos:   in.fset.Position(pos).String(),
+		Func:  name,
+		Class: class,
+		pos:   in.fset.Position(pos),
+	})
+}
+
+func (in *instrumenter) instrumentDecl(ctx context.Context, x *ast.FuncDecl) error {
+	if x.Body == nil {
+		in.skip(x.Pos(), x.Name.Name, skipNoBody, "no body")
+		return nil
+	}
+	if x.Doc != nil {
+		for _, docc := range x.Doc.List {
+			if docc.Text == "//elephandog:ignore-trace" {
+				in.skip(x.Pos(), x.Name.Name, skipIgnoreDirective, "ignore-trace directive")
+				if in.takesCtx(x.Type) {
+					in.cover(x.Type.Pos(), x.Name.Name, false)
 				}
 				return nil
-			}(); err != nil {
-				return err
+			}
+			if docc.Text == "//elephandog:append-trace" {
+				in.skip(x.Pos(), x.Name.Name, skipIgnoreDirective, "append-trace directive")
+				return nil
 			}
 		}
 	}
+	if in.opts.ReachableFromRoutes {
+		if fn, ok := in.info.Defs[x.Name].(*types.Func); !ok || !in.reachable[fn.FullName()] {
+			in.skip(x.Pos(), x.Name.Name, skipUnreachable, "not reachable from routes")
+			if in.takesCtx(x.Type) {
+				in.cover(x.Type.Pos(), x.Name.Name, false)
+			}
+			return nil
+		}
+	}
+	if err := in.instrumentFuncLits(ctx, x.Body, x.Name.Name, 1); err != nil {
+		return err
+	}
+	attrs, err := traceAttrs(x.Doc, in.pkgName(attributePkgPath))
+	if err != nil {
+		return fmt.Errorf("%s: %w", in.fset.Position(x.Pos()), err)
+	}
+	name := x.Name.Name
+	if fn, ok := in.info.Defs[x.Name].(*types.Func); ok {
+		if route, ok := in.routes[fn.FullName()]; ok {
+			if in.opts.RouteNames {
+				name = route
+			}
+			if in.opts.RouteAttr {
+				_, path, _ := strings.Cut(route, " ")
+				attrs = append(attrs, attributeCall(in.pkgName(attributePkgPath), "String", routeAttrKey, &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}))
+			}
+		}
+	}
+	if custom, ok, err := spanName(x.Doc); err != nil {
+		return fmt.Errorf("%s: %w", in.fset.Position(x.Pos()), err)
+	} else if ok {
+		name = custom
+	}
+	return in.instrument(ctx, name, x.Type, x.Body, attrs)
+}
+
+// instrumentFuncLits instruments function literals nested in body up to opts.MaxNesting levels deep.
+// Literals are named after their enclosing function like the Go runtime does (Outer.func1, Outer.func1.1).
+func (in *instrumenter) instrumentFuncLits(ctx context.Context, body *ast.BlockStmt, parent string, depth int) error {
+	if depth > in.opts.MaxNesting {
+		return nil
+	}
+	var n int
+	var err error
+	ast.Inspect(body, func(node ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		lit, ok := node.(*ast.FuncLit)
+		if !ok {
+			return true
+		}
+		n++
+		name := fmt.Sprintf("%s.%d", parent, n)
+		if depth == 1 {
+			name = fmt.Sprintf("%s.func%d", parent, n)
+		}
+		if err = in.instrumentFuncLits(ctx, lit.Body, name, depth+1); err != nil {
+			return false
+		}
+		err = in.instrument(ctx, name, lit.Type, lit.Body, nil)
+		return false
+	})
+	return err
+}
+
+func (in *instrumenter) instrument(ctx context.Context, name string, ftype *ast.FuncType, body *ast.BlockStmt, attrs []ast.Expr) error {
+	echoVar, ok := tracedParam(ftype)
+	var ctxArg string
+	if !ok {
+		// tracedParam reports a param named c as an echo.Context whatever its type
+		echoVar = false
+		if ctxArg, ok = in.contextParam(ftype); !ok {
+			in.skip(ftype.Pos(), name, skipWrongSignature, "first param is not ctx context.Context, c echo.Context or a context.Context implementation")
+			return nil
+		}
+	}
+	var ctxFrom ast.Expr
+	if echoVar {
+		rhs, err := in.opts.ctxExpr("c")
+		if err != nil {
+			return err
+		}
+		ctxFrom = rhs
+	}
+	return in.insertSpan(ctx, name, ftype, body, attrs, ctxFrom, ctxArg)
+}
+
+// insertSpan inserts the span start into body, preceded by ctx := ctxFrom unless ctxFrom is nil
+// or body assigns ctx first. The span is started from the var named ctxArg instead of ctx unless
+// it is empty.
+func (in *instrumenter) insertSpan(ctx context.Context, name string, ftype *ast.FuncType, body *ast.BlockStmt, attrs []ast.Expr, ctxFrom ast.Expr, ctxArg string) error {
+	if slices.ContainsFunc(body.List, isSpanStart) || slices.ContainsFunc(body.List, isTimingLog) {
+		// instrumented by a previous run, or kept by removal as the span is used otherwise
+		in.skip(ftype.Pos(), name, skipAlreadyInstrumented, "already instrumented")
+		in.cover(ftype.Pos(), name, true)
+		return nil
+	}
+	if in.opts.ExistingStart != nil && hasExistingStart(body, in.opts.ExistingStart) {
+		slog.DebugContext(ctx, "already instrumented", slog.String("name", name))
+		in.skip(ftype.Pos(), name, skipAlreadyInstrumented, "already instrumented")
+		in.cover(ftype.Pos(), name, true)
+		return nil
+	}
+	in.cover(ftype.Pos(), name, false)
+	if in.confirmer != nil && !in.confirmer.confirm(in.fset.Position(ftype.Pos()).String(), name) {
+		in.skip(ftype.Pos(), name, skipDeclined, "declined")
+		return nil
+	}
+	slog.DebugContext(ctx, "func", slog.String("name", name))
+	if in.opts.Mode == modeLog {
+		in.needsTime = true
+		return in.insertStmts(name, ftype, body, 0, []ast.Stmt{timingLogStmt(in.logFuncExpr(), in.pkgName("time"), name)})
+	}
+	var at int
+	stmts := tracerStmts(in.tracerExpr(), name)
+	start := stmts[0].(*ast.AssignStmt)
+	if ctxArg != "" {
+		start.Rhs[0].(*ast.CallExpr).Args[0] = &ast.Ident{Name: ctxArg}
+	}
+	if ctxFrom != nil {
+		if in.opts.SpanAfterParse {
+			at = parseEnd(body.List, handlerParam(ftype))
+		}
+		found := false
+		for i, stmt := range body.List[at:] {
+			if astmt, ok := stmt.(*ast.AssignStmt); ok {
+				ident := astmt.Lhs[0]
+				if ident.(*ast.Ident).Name != "ctx" {
+					in.skip(ftype.Pos(), name, skipWrongSignature, "first assignment is not to ctx")
+					return nil
+				}
+				at, found = at+i+1, true
+				break
+			}
+		}
+		if !found {
+			stmts = append(echoCtxAssignStmt(ctxFrom), stmts...)
+		}
+	}
+	if ctxArg == "" && (in.opts.PropagateCtx || in.opts.CaptureCtx && passesCtx(body.List[at:])) {
+		// ctx, span := tracer.Start(ctx, name) so that the calls are in the span; a custom
+		// context type cannot be assigned the context.Context returned by Start
+		start.Lhs[0] = &ast.Ident{Name: "ctx"}
+	}
+	if in.opts.Nolint != "" {
+		var b strings.Builder
+		if err := format.Node(&b, token.NewFileSet(), start); err != nil {
+			return fmt.Errorf("failed to format span start: func=%s, %w", name, err)
+		}
+		// commented once printed, as the statement has no position to attach a comment to
+		in.nolintStarts = append(in.nolintStarts, b.String())
+	}
+	if len(attrs) > 0 {
+		stmts = append(stmts, setAttributesStmt(attrs))
+		in.needsAttribute = true
+	}
+	if echoVar, ok := tracedParam(ftype); ok && echoVar && in.opts.StatusFromResponse && writesStatus(body, "c") {
+		stmts = append(stmts, statusStmt("c", in.pkgName(attributePkgPath), in.pkgName(codesPkgPath)))
+		in.needsAttribute = true
+		in.needsCodes = true
+	}
+	if in.opts.WrapBody && returnsOnlyError(ftype) {
+		// stmts precede the wrapped body, which refers to what is declared before it as is
+		errName := freeName(ftype, append(slices.Clip(body.List[:at]), stmts...), "err")
+		wrapped := wrapBodyStmts(body.List[at:], in.pkgName(codesPkgPath), errName, body.Rbrace)
+		// the literal, closed on another line, is not put on a single line, and the statements
+		// following it are positioned at its end
+		pos, litPos := in.insertPos(body, at)
+		setPos(stmts, pos, litPos)
+		setPos(wrapped[:1], pos, pos)
+		setPos(wrapped[1:], body.Rbrace, body.Rbrace)
+		stmts = append(stmts, wrapped...)
+		body.List = append(slices.Clip(body.List[:at]), stmts...)
+		in.needsCodes = true
+		in.modified = true
+		in.classify(ftype.Pos(), name, "instrument")
+		in.insertions += len(stmts)
+		return nil
+	}
+	return in.insertStmts(name, ftype, body, at, stmts)
+}
+
+// insertStmts inserts stmts into body at index at, planning the edit for plan and minimal-diff.
+func (in *instrumenter) insertStmts(name string, ftype *ast.FuncType, body *ast.BlockStmt, at int, stmts []ast.Stmt) error {
+	if in.opts.Plan != "" || in.opts.MinimalDiff {
+		edit, err := planEdit(in.fset, in.src, body, at, stmts)
+		if err != nil {
+			return fmt.Errorf("failed to plan edit: func=%s, %w", name, err)
+		}
+		if in.opts.Nolint != "" && slices.ContainsFunc(stmts, isSpanStart) {
+			edit.NewText = string(withTrailingComment([]byte(edit.NewText), in.nolintStarts[len(in.nolintStarts)-1], in.nolintComment()))
+		}
+		in.edits = append(in.edits, edit)
+		in.plans = append(in.plans, &FuncPlan{
+			Filename: in.fset.Position(body.Pos()).Filename,
+			Func:     name,
+			Edits:    []TextEdit{edit},
+		})
+	}
+	pos, litPos := in.insertPos(body, at)
+	setPos(stmts, pos, litPos)
+	body.List = slices.Insert(body.List, at, stmts...)
+	in.modified = true
+	in.classify(ftype.Pos(), name, "instrument")
+	in.insertions += len(stmts)
+	return nil
+}
+
+type buildTarget struct {
+	goos   string
+	goarch string
+}
 
+// buildTargets returns the combinations of goos and goarch, an empty list meaning the host's.
+func buildTargets(goos, goarch []string) []buildTarget {
+	if len(goos) == 0 {
+		goos = []string{""}
+	}
+	if len(goarch) == 0 {
+		goarch = []string{""}
+	}
+	var targets []buildTarget
+	for _, gos := range goos {
+		for _, arch := range goarch {
+			targets = append(targets, buildTarget{goos: gos, goarch: arch})
+		}
+	}
+	return targets
+}
+
+// env returns the environment to load packages for t, nil for the host.
+func (t buildTarget) env() []string {
+	if t.goos == "" && t.goarch == "" {
+		return nil
+	}
+	env := os.Environ()
+	if t.goos != "" {
+		env = append(env, "GOOS="+t.goos)
+	}
+	if t.goarch != "" {
+		env = append(env, "GOARCH="+t.goarch)
+	}
+	return env
+}
+
+// backupFile copies filename to filename.orig, keeping an existing backup unless force is set.
+func backupFile(ctx context.Context, filename string, force bool) error {
+	backup := filename + ".orig"
+	if _, err := os.Stat(backup); err == nil && !force {
+		slog.DebugContext(ctx, "backup already exists", slog.String("filename", backup))
+		return nil
+	}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file to back up: %w", err)
+	}
+	if err := os.WriteFile(backup, src, 0o644); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// diffStat summarizes a run like git diff --stat, e.g. "42 files changed, 380 insertions(+)",
+// counting inserted and deleted statements rather than lines.
+func diffStat(files, insertions, deletions int) string {
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, one)
+		}
+		return fmt.Sprintf("%d %s", n, many)
+	}
+	stat := plural(files, "file changed", "files changed")
+	if insertions > 0 {
+		stat += ", " + plural(insertions, "insertion(+)", "insertions(+)")
+	}
+	if deletions > 0 {
+		stat += ", " + plural(deletions, "deletion(-)", "deletions(-)")
+	}
+	return stat
+}
+
+// tracerExpr returns the expression the span is started from: the package level tracer var,
+// or a call like tracing.Tracer("example.com/app/pkg") when opts.TracerFunc is set.
+func (in *instrumenter) tracerExpr() ast.Expr {
+	if in.opts.TracerFunc == "" {
+		return &ast.Ident{Name: "tracer"}
+	}
+	fun, _ := parser.ParseExpr(in.opts.TracerFunc)
+	return &ast.CallExpr{
+		Fun:  fun,
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("%q", in.pkgPath)}},
+	}
+}
+
+// addTracerImport imports importPath, naming the import after the qualifier of tracerFunc
+// when it differs from the last element of the path.
+func addTracerImport(fset *token.FileSet, f *ast.File, tracerFunc, importPath string) bool {
+	var name string
+	fun, _ := parser.ParseExpr(tracerFunc)
+	if sel, ok := fun.(*ast.SelectorExpr); ok {
+		if x, ok := sel.X.(*ast.Ident); ok && x.Name != path.Base(importPath) {
+			name = x.Name
+		}
+	}
+	return astutil.AddNamedImport(fset, f, name, importPath)
+}
+
+// hasExistingStart reports whether body calls a function matching re, like trace.StartSpan(ctx, ...).
+// Calls in nested function literals are not considered.
+func hasExistingStart(body *ast.BlockStmt, re *regexp.Regexp) bool {
+	found := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		if found {
+			return false
+		}
+		switch x := node.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if re.MatchString(types.ExprString(x.Fun)) {
+				found = true
+				return false
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// takesCtx reports whether the first parameter of ftype is one spans are started from.
+func (in *instrumenter) takesCtx(ftype *ast.FuncType) bool {
+	if _, ok := tracedParam(ftype); ok {
+		return true
+	}
+	_, ok := in.contextParam(ftype)
+	return ok
+}
+
+// contextParam reports whether the first parameter has a type implementing context.Context,
+// e.g. a request context type embedding it, returning its name.
+func (in *instrumenter) contextParam(ftype *ast.FuncType) (string, bool) {
+	list := ftype.Params.List
+	if in.contextIface == nil || len(list) == 0 || len(list[0].Names) == 0 || list[0].Names[0].Name == "_" {
+		return "", false
+	}
+	t := in.info.TypeOf(list[0].Type)
+	if t == nil || !types.Implements(t, in.contextIface) {
+		return "", false
+	}
+	return list[0].Names[0].Name, true
+}
+
+// lookupContextIface returns the context.Context interface from the packages pkg imports
+// directly or indirectly, or nil if none refers to the context package.
+func lookupContextIface(pkg *types.Package) *types.Interface {
+	seen := map[*types.Package]bool{}
+	queue := []*types.Package{pkg}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if p.Path() == "context" {
+			if obj, ok := p.Scope().Lookup("Context").(*types.TypeName); ok {
+				iface, _ := obj.Type().Underlying().(*types.Interface)
+				return iface
+			}
+			return nil
+		}
+		for _, imp := range p.Imports() {
+			if !seen[imp] {
+				seen[imp] = true
+				queue = append(queue, imp)
+			}
+		}
+	}
 	return nil
 }
 
-func tracerStmts(name string) []ast.Stmt {
+// tracedParam reports whether the first parameter is a ctx context.Context or a c echo.Context.
+func tracedParam(ftype *ast.FuncType) (echoVar bool, ok bool) {
+	list := ftype.Params.List
+	if len(list) == 0 || len(list[0].Names) == 0 {
+		return false, false
+	}
+	estimateCtx := list[0]
+	t, ok := estimateCtx.Type.(*ast.SelectorExpr)
+	if !ok {
+		return false, false
+	}
+	n, ok := t.X.(*ast.Ident)
+	if !ok {
+		return false, false
+	}
+	switch estimateCtx.Names[0].Name {
+	case "c":
+		return true, n.Name == "echo" && t.Sel.Name == "Context"
+	case "ctx":
+		return false, n.Name == "context" && t.Sel.Name == "Context"
+	default:
+		return false, false
+	}
+}
+
+// FuncPlan is the edits of a function, or of the file, like added imports, if Func is empty.
+type FuncPlan struct {
+	Filename string     `json:"filename"`
+	Func     string     `json:"func"`
+	Edits    []TextEdit `json:"edits"`
+}
+
+// TextEdit replaces the bytes in [Offset, End) of the file with NewText.
+type TextEdit struct {
+	Offset  int    `json:"offset"`
+	End     int    `json:"end"`
+	NewText string `json:"newText"`
+}
+
+// planEdit computes the insertion of stmts into body at index at, indented one level
+// deeper than the line of the opening brace in src. What follows on the same line, as in a
+// one-line body, is moved to the next line.
+func planEdit(fset *token.FileSet, src []byte, body *ast.BlockStmt, at int, stmts []ast.Stmt) (TextEdit, error) {
+	pos := body.Lbrace + 1
+	if at > 0 {
+		pos = body.List[at-1].End()
+	}
+	braceIndent := lineIndent(src, fset.Position(body.Lbrace).Offset)
+	indent := braceIndent + "\t"
+	var buf bytes.Buffer
+	for _, stmt := range stmts {
+		var b bytes.Buffer
+		if err := format.Node(&b, token.NewFileSet(), stmt); err != nil {
+			return TextEdit{}, fmt.Errorf("failed to format stmt: %w", err)
+		}
+		// the lines of a statement spanning several, like a deferred func, are indented too
+		buf.WriteString("\n" + indent + strings.ReplaceAll(b.String(), "\n", "\n"+indent))
+	}
+	offset := fset.Position(pos).Offset
+	end := offset
+	next, nextIndent := body.Rbrace, braceIndent
+	if at < len(body.List) {
+		next, nextIndent = body.List[at].Pos(), indent
+	}
+	if fset.Position(next).Line == fset.Position(pos).Line {
+		buf.WriteString("\n" + nextIndent)
+		// the spaces before it are replaced, comments kept
+		if nextOffset := fset.Position(next).Offset; len(bytes.TrimSpace(src[offset:nextOffset])) == 0 {
+			end = nextOffset
+		}
+	}
+	return TextEdit{Offset: offset, End: end, NewText: buf.String()}, nil
+}
+
+// importDeclsRange returns the range of the import decls of f, or the end of the package clause if
+// it has none.
+func importDeclsRange(f *ast.File) (token.Pos, token.Pos) {
+	var from, to token.Pos
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			break
+		}
+		if !from.IsValid() {
+			from = gen.Pos()
+		}
+		to = gen.End()
+	}
+	if !from.IsValid() {
+		return f.Name.End(), f.Name.End()
+	}
+	return from, to
+}
+
+// importEdit computes the replacement of the import decls of the source in [from, to) by those of f.
+func importEdit(fset *token.FileSet, f *ast.File, from, to token.Pos) (TextEdit, error) {
+	var buf bytes.Buffer
+	if from == to {
+		buf.WriteString("\n\n")
+	}
+	for i, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			break
+		}
+		if i > 0 {
+			buf.WriteString("\n\n")
+		}
+		if err := format.Node(&buf, fset, &printer.CommentedNode{Node: gen, Comments: f.Comments}); err != nil {
+			return TextEdit{}, fmt.Errorf("failed to format imports: %w", err)
+		}
+	}
+	return TextEdit{Offset: fset.Position(from).Offset, End: fset.Position(to).Offset, NewText: buf.String()}, nil
+}
+
+// passesCtx reports whether a call in stmts, including in function literals, is passed ctx.
+func passesCtx(stmts []ast.Stmt) bool {
+	found := false
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok && slices.ContainsFunc(call.Args, func(arg ast.Expr) bool {
+				return isIdent(arg, "ctx")
+			}) {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// insertPos returns the position of the statements inserted into body at index at: the end of the
+// line of the opening brace or the preceding statement, so that a comment ending the line stays
+// on it, unless what follows is on the same line. litPos is the start of the next line then, for
+// setPos.
+func (in *instrumenter) insertPos(body *ast.BlockStmt, at int) (pos, litPos token.Pos) {
+	pos = body.Lbrace
+	if at > 0 {
+		pos = body.List[at-1].End()
+	}
+	next := body.Rbrace
+	if at < len(body.List) {
+		next = body.List[at].Pos()
+	}
+	file := in.fset.File(pos)
+	if file == nil {
+		return pos, pos
+	}
+	line := file.Line(pos)
+	if line >= file.LineCount() || file.Line(next) == line {
+		return pos, pos
+	}
+	return file.LineStart(line+1) - 1, file.LineStart(line + 1)
+}
+
+// setPos positions the nodes of stmts that have no position at pos. The printer otherwise
+// estimates their positions from the printed length and flushes the comments that follow,
+// such as the doc comment of the next func, into the inserted statements. Function literals but
+// their func keyword are positioned at litPos, as the printer puts the body of a literal on a
+// single line if it fits and its signature is on the line of the keyword.
+func setPos(stmts []ast.Stmt, pos, litPos token.Pos) {
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, posVisitor(pos, litPos))
+	}
+}
+
+func posVisitor(pos, litPos token.Pos) func(ast.Node) bool {
+	return func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if !n.NamePos.IsValid() {
+				n.NamePos = pos
+			}
+		case *ast.BasicLit:
+			if !n.ValuePos.IsValid() {
+				n.ValuePos = pos
+			}
+		case *ast.CallExpr:
+			if !n.Lparen.IsValid() {
+				n.Lparen = pos
+			}
+			if !n.Rparen.IsValid() {
+				n.Rparen = pos
+			}
+		case *ast.BinaryExpr:
+			if !n.OpPos.IsValid() {
+				n.OpPos = pos
+			}
+		case *ast.AssignStmt:
+			if !n.TokPos.IsValid() {
+				n.TokPos = pos
+			}
+		case *ast.DeferStmt:
+			if !n.Defer.IsValid() {
+				n.Defer = pos
+			}
+		case *ast.ReturnStmt:
+			if !n.Return.IsValid() {
+				n.Return = pos
+			}
+		case *ast.IfStmt:
+			if !n.If.IsValid() {
+				n.If = pos
+			}
+		case *ast.BlockStmt:
+			if !n.Lbrace.IsValid() {
+				n.Lbrace = pos
+			}
+			if !n.Rbrace.IsValid() {
+				n.Rbrace = pos
+			}
+		case *ast.FieldList:
+			if !n.Opening.IsValid() {
+				n.Opening = pos
+			}
+			if !n.Closing.IsValid() {
+				n.Closing = pos
+			}
+		case *ast.FuncLit:
+			if !n.Type.Func.IsValid() {
+				n.Type.Func = pos
+			}
+			visit := posVisitor(litPos, litPos)
+			ast.Inspect(n.Type.Params, visit)
+			if n.Type.Results != nil {
+				ast.Inspect(n.Type.Results, visit)
+			}
+			ast.Inspect(n.Body, visit)
+			return false
+		}
+		return true
+	}
+}
+
+func tracerStmts(tracer ast.Expr, name string) []ast.Stmt {
 	return []ast.Stmt{
 		&ast.AssignStmt{
 			Lhs: []ast.Expr{
@@ -152,12 +1416,12 @@ func tracerStmts(name string) []ast.Stmt {
 			Rhs: []ast.Expr{
 				&ast.CallExpr{
 					Fun: &ast.SelectorExpr{
-						X:   &ast.Ident{Name: "tracer"},
+						X:   tracer,
 						Sel: &ast.Ident{Name: "Start"},
 					},
 					Args: []ast.Expr{
 						&ast.Ident{Name: "ctx"},
-						&ast.BasicLit{Value: fmt.Sprintf("%q", name)},
+						&ast.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("%q", name)},
 					},
 				},
 			},
@@ -173,32 +1437,88 @@ func tracerStmts(name string) []ast.Stmt {
 	}
 }
 
-func echoCtxAssignStmt() []ast.Stmt {
+// nolintComment returns the comment -nolint appends to span starts.
+func (in *instrumenter) nolintComment() string {
+	return "//nolint:" + in.opts.Nolint
+}
+
+// withNolint appends the -nolint comment to the span starts inserted into the file printed as src.
+func (in *instrumenter) withNolint(src []byte) []byte {
+	for _, stmt := range in.nolintStarts {
+		src = withTrailingComment(src, stmt, in.nolintComment())
+	}
+	return src
+}
+
+// withTrailingComment appends comment to the first line of src reading stmt, the printed form of
+// a generated statement, that has no comment yet, returning src unchanged if there is none.
+func withTrailingComment(src []byte, stmt, comment string) []byte {
+	lines := strings.SplitAfter(string(src), "\n")
+	for i, line := range lines {
+		body := strings.TrimRight(line, "\n")
+		if strings.TrimSpace(body) == stmt {
+			lines[i] = body + " " + comment + line[len(body):]
+			return []byte(strings.Join(lines, ""))
+		}
+	}
+	return src
+}
+
+func echoCtxAssignStmt(rhs ast.Expr) []ast.Stmt {
 	return []ast.Stmt{
 		&ast.AssignStmt{
 			Lhs: []ast.Expr{
 				&ast.Ident{Name: "ctx"},
 			},
 			Tok: token.DEFINE,
-			Rhs: []ast.Expr{
-				&ast.CallExpr{
-					Fun: &ast.SelectorExpr{
-						X: &ast.CallExpr{
-							Fun: &ast.SelectorExpr{
-								X: &ast.Ident{
-									Name: "c",
-								},
-								Sel: &ast.Ident{
-									Name: "Request",
-								},
-							},
-						},
-						Sel: &ast.Ident{
-							Name: "Context",
-						},
+			Rhs: []ast.Expr{rhs},
+		},
+	}
+}
+
+// echoCtxExpr returns c.Request().Context() for the echo.Context param.
+func echoCtxExpr(param string) ast.Expr {
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X: &ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X: &ast.Ident{
+						Name: param,
+					},
+					Sel: &ast.Ident{
+						Name: "Request",
 					},
 				},
 			},
+			Sel: &ast.Ident{
+				Name: "Context",
+			},
 		},
 	}
 }
+
+func lineIndent(src []byte, offset int) string {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
+
+// applyEdits applies non-overlapping edits to src.
+func applyEdits(src []byte, edits []TextEdit) []byte {
+	edits = slices.Clone(edits)
+	slices.SortStableFunc(edits, func(a, b TextEdit) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		buf.Write(src[last:e.Offset])
+		buf.WriteString(e.NewText)
+		last = e.End
+	}
+	buf.Write(src[last:])
+	return buf.Bytes()
+}
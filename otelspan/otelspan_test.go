@@ -0,0 +1,1783 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"go/parser"
+	"go/token"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestMain(m *testing.M) {
+	// type check the dependencies from source, as the export data of a toolchain newer than
+	// x/tools cannot be read
+	loadMode |= packages.NeedDeps
+	os.Exit(m.Run())
+}
+
+// fakeModules are stand-ins for the modules generated code and handlers refer to, so that tests
+// build instrumented code without fetching them.
+var fakeModules = map[string]map[string]string{
+	"go.opentelemetry.io/otel": {
+		"attribute/attribute.go": `package attribute
+
+type KeyValue struct {
+	Key   string
+	Value any
+}
+
+func String(k, v string) KeyValue   { return KeyValue{k, v} }
+func Int(k string, v int) KeyValue  { return KeyValue{k, v} }
+func Bool(k string, v bool) KeyValue { return KeyValue{k, v} }
+`,
+		"codes/codes.go": `package codes
+
+type Code uint32
+
+const (
+	Unset Code = iota
+	Error
+	Ok
+)
+`,
+	},
+	"github.com/labstack/echo/v4": {
+		"echo.go": `package echo
+
+import "net/http"
+
+type HandlerFunc func(Context) error
+
+type Response struct {
+	Committed bool
+	Status    int
+}
+
+type Context interface {
+	Request() *http.Request
+	SetRequest(*http.Request)
+	Response() *Response
+	Param(name string) string
+	QueryParam(name string) string
+	Bind(i any) error
+	JSON(code int, i any) error
+	NoContent(code int) error
+}
+
+// NewContext returns a Context of r, recording the status written.
+func NewContext(r *http.Request) Context {
+	return &context{req: r, res: &Response{}}
+}
+
+type context struct {
+	req *http.Request
+	res *Response
+}
+
+func (c *context) Request() *http.Request          { return c.req }
+func (c *context) SetRequest(r *http.Request)      { c.req = r }
+func (c *context) Response() *Response             { return c.res }
+func (c *context) Param(name string) string        { return "" }
+func (c *context) QueryParam(name string) string   { return c.req.URL.Query().Get(name) }
+func (c *context) Bind(i any) error                { return nil }
+func (c *context) JSON(code int, i any) error      { return c.NoContent(code) }
+
+func (c *context) NoContent(code int) error {
+	c.res.Committed, c.res.Status = true, code
+	return nil
+}
+
+type Echo struct{}
+
+func New() *Echo                                  { return &Echo{} }
+func (e *Echo) GET(path string, h HandlerFunc)    {}
+func (e *Echo) POST(path string, h HandlerFunc)   {}
+`,
+	},
+}
+
+// tracerSrc declares the package level tracer var generated spans are started from.
+const tracerSrc = `package app
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var tracer fakeTracer
+
+// recordedErrs, recordedStatuses and recordedAttrs are what is recorded on spans.
+var (
+	recordedErrs     []error
+	recordedStatuses []codes.Code
+	recordedAttrs    []attribute.KeyValue
+)
+
+type fakeTracer struct{}
+
+type fakeSpan struct{}
+
+type spanNameKey struct{}
+
+//elephandog:ignore-trace
+func (fakeTracer) Start(ctx context.Context, name string) (context.Context, fakeSpan) {
+	return context.WithValue(ctx, spanNameKey{}, name), fakeSpan{}
+}
+
+// spanName returns the name of the span of ctx.
+//
+//elephandog:ignore-trace
+func spanName(ctx context.Context) string {
+	name, _ := ctx.Value(spanNameKey{}).(string)
+	return name
+}
+
+func (fakeSpan) End()                  {}
+func (fakeSpan) RecordError(err error) { recordedErrs = append(recordedErrs, err) }
+
+func (fakeSpan) SetStatus(code codes.Code, _ string) {
+	recordedStatuses = append(recordedStatuses, code)
+}
+
+func (fakeSpan) SetAttributes(kv ...attribute.KeyValue) {
+	recordedAttrs = append(recordedAttrs, kv...)
+}
+`
+
+// testModule writes files to a temporary module example.com/app requiring the fakeModules and
+// returns its dir.
+func testModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	deps := t.TempDir()
+	gomod := "module example.com/app\n\ngo 1.23\n\nrequire (\n"
+	var replaces string
+	for mod, modFiles := range fakeModules {
+		modDir := filepath.Join(deps, filepath.FromSlash(mod))
+		writeFiles(t, modDir, modFiles)
+		writeFiles(t, modDir, map[string]string{"go.mod": "module " + mod + "\n\ngo 1.23\n"})
+		version := "v1.0.0"
+		if strings.HasSuffix(mod, "/v4") {
+			version = "v4.0.0"
+		}
+		gomod += "\t" + mod + " " + version + "\n"
+		replaces += "replace " + mod + " => " + modDir + "\n"
+	}
+	gomod += ")\n\n" + replaces
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"go.mod": gomod})
+	writeFiles(t, dir, files)
+	return dir
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// run runs otelspan on dir with opts and returns what it prints.
+func run(t *testing.T, dir string, opts *Opts) string {
+	t.Helper()
+	out, err := runErr(t, dir, opts)
+	if err != nil {
+		t.Fatalf("Run: %v\n%s", err, out)
+	}
+	return out
+}
+
+// runErr is run returning the error of Run.
+func runErr(t *testing.T, dir string, opts *Opts) (string, error) {
+	t.Helper()
+	var err error
+	out := capture(t, &os.Stdout, func() {
+		err = Run(context.Background(), dir, opts)
+	})
+	return out, err
+}
+
+// capture returns what is written to *file, e.g. os.Stderr, while f runs.
+func capture(t *testing.T, file **os.File, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := *file
+	*file = w
+	done := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- b
+	}()
+	f()
+	*file = orig
+	w.Close()
+	return string(<-done)
+}
+
+// build fails t unless the module at dir compiles.
+func build(t *testing.T, dir string) {
+	t.Helper()
+	goCmd(t, dir, "vet", "./...")
+}
+
+func goCmd(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func One(ctx context.Context) error { return nil }
+
+func Two(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	out := run(t, dir, &Opts{Plan: "json"})
+	var plans []*FuncPlan
+	if err := json.Unmarshal([]byte(out), &plans); err != nil {
+		t.Fatalf("invalid plan: %v\n%s", err, out)
+	}
+	if len(plans) != 2 {
+		t.Fatalf("got %d plans, want 2\n%s", len(plans), out)
+	}
+	var edits []TextEdit
+	for _, p := range plans {
+		if p.Filename != filepath.Join(dir, "a.go") {
+			t.Errorf("filename = %s", p.Filename)
+		}
+		for _, e := range p.Edits {
+			if e.Offset < 0 || e.Offset > e.End || e.End > len(src) {
+				t.Errorf("%s: invalid range [%d, %d)", p.Func, e.Offset, e.End)
+			}
+			edits = append(edits, e)
+		}
+	}
+	applied := applyEdits([]byte(src), edits)
+	if _, err := parser.ParseFile(token.NewFileSet(), "a.go", applied, 0); err != nil {
+		t.Fatalf("plan applied does not parse: %v\n%s", err, applied)
+	}
+	for _, name := range []string{"One", "Two"} {
+		if !bytes.Contains(applied, []byte(`tracer.Start(ctx, "`+name+`")`)) {
+			t.Errorf("no span started for %s:\n%s", name, applied)
+		}
+	}
+	if !strings.Contains(string(applied), "defer span.End()\n\treturn nil }") {
+		t.Errorf("one-line body not split:\n%s", applied)
+	}
+}
+
+func TestMinimalDiff(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func One(ctx context.Context) error { return nil }
+
+func Two(ctx context.Context) error {
+	x :=   1
+	_ = x
+    return nil
+}
+
+var unformatted = map[string]int{"a":1,
+	"bb": 2}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, MinimalDiff: true})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	for _, unchanged := range []string{"\tx :=   1\n", "    return nil\n", `map[string]int{"a":1,`} {
+		if !strings.Contains(got, unchanged) {
+			t.Errorf("%q not preserved:\n%s", unchanged, got)
+		}
+	}
+	if !strings.Contains(got, "func One(ctx context.Context) error {\n\t_, span := tracer.Start(ctx, \"One\")\n\tdefer span.End()\n\treturn nil }") {
+		t.Errorf("one-line body not instrumented:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestRemoveHandler(t *testing.T) {
+	src := `package app
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+func Get(c echo.Context) error {
+	return c.NoContent(200)
+}
+
+func Use(c echo.Context) error {
+	ctx := c.Request().Context()
+	return load(ctx)
+}
+
+func load(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true})
+	if got := readFile(t, filepath.Join(dir, "a.go")); strings.Count(got, "tracer.Start") != 3 {
+		t.Fatalf("not instrumented:\n%s", got)
+	}
+	run(t, dir, &Opts{Fix: true, Remove: true})
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != src {
+		t.Errorf("not restored:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestResync(t *testing.T) {
+	src := `package app
+
+import "context"
+
+// GetUser loads a user.
+func GetUser(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	filename := filepath.Join(dir, "a.go")
+	run(t, dir, &Opts{Fix: true})
+	// the naming rule changes after the first run
+	renamed := strings.Replace(readFile(t, filename), "func GetUser", "//elephandog:name \"LoadUser\"\nfunc GetUser", 1)
+	writeFiles(t, dir, map[string]string{"a.go": renamed})
+	run(t, dir, &Opts{Fix: true, Resync: true, Nolint: "errcheck"})
+	got := readFile(t, filename)
+	if strings.Count(got, "tracer.Start") != 1 || !strings.Contains(got, `tracer.Start(ctx, "LoadUser") //nolint:errcheck`) {
+		t.Errorf("not resynced:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestWrapBody(t *testing.T) {
+	src := `package app
+
+import (
+	"context"
+	"errors"
+)
+
+var errOdd = errors.New("odd")
+
+func Check(ctx context.Context, n int, err error) error {
+	if err != nil {
+		return err
+	}
+	if n%2 == 1 {
+		return errOdd
+	}
+	return nil
+}
+`
+	test := `package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	errArg := errors.New("arg")
+	for _, tt := range []struct {
+		n    int
+		err  error
+		want error
+	}{{1, errArg, errArg}, {1, nil, errOdd}, {2, nil, nil}} {
+		recordedErrs = nil
+		if err := Check(context.Background(), tt.n, tt.err); err != tt.want {
+			t.Errorf("Check(%d, %v) = %v, want %v", tt.n, tt.err, err, tt.want)
+		}
+		if tt.want == nil && len(recordedErrs) != 0 || tt.want != nil && (len(recordedErrs) != 1 || recordedErrs[0] != tt.want) {
+			t.Errorf("Check(%d, %v) recorded %v, want %v", tt.n, tt.err, recordedErrs, tt.want)
+		}
+	}
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "a_test.go": test, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, WrapBody: true})
+	// the param err is not redeclared
+	if got := readFile(t, filepath.Join(dir, "a.go")); !strings.Contains(got, "err2 := func() error {") {
+		t.Errorf("body not wrapped:\n%s", got)
+	}
+	goCmd(t, dir, "test", "./...")
+}
+
+func TestSpanAfterParse(t *testing.T) {
+	src := `package app
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type request struct {
+	Name string
+}
+
+func Update(c echo.Context) error {
+	n, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	var req request
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	return c.JSON(200, map[string]any{"n": n, "name": req.Name})
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, SpanAfterParse: true, WrapBody: true})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	want := `	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	_, span := tracer.Start(ctx, "Update")
+	defer span.End()
+	err2 := func() error {
+		return c.JSON(200, map[string]any{"n": n, "name": req.Name})
+	}()
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("span not started after the parse block:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestPlanImports(t *testing.T) {
+	handlers := `package app
+
+import "github.com/labstack/echo/v4"
+
+func Register(e *echo.Echo) {
+	e.GET("/users/:id", GetUser)
+}
+
+func GetUser(c echo.Context) error {
+	return c.NoContent(404)
+}
+`
+	directives := `package app
+
+import (
+	// for the ctx
+	"context"
+)
+
+//elephandog:trace-attr component=billing retries=3
+func Charge(ctx context.Context) error {
+	return nil
+}
+`
+	files := map[string]string{"handlers.go": handlers, "directives.go": directives}
+	dir := testModule(t, map[string]string{"tracer.go": tracerSrc})
+	writeFiles(t, dir, files)
+	out := run(t, dir, &Opts{Plan: "json", RouteAttr: true, StatusFromResponse: true})
+	var plans []*FuncPlan
+	if err := json.Unmarshal([]byte(out), &plans); err != nil {
+		t.Fatalf("invalid plan: %v\n%s", err, out)
+	}
+	edits := map[string][]TextEdit{}
+	for _, p := range plans {
+		name := filepath.Base(p.Filename)
+		edits[name] = append(edits[name], p.Edits...)
+	}
+	for name, src := range files {
+		writeFiles(t, dir, map[string]string{name: string(applyEdits([]byte(src), edits[name]))})
+	}
+	if got := readFile(t, filepath.Join(dir, "handlers.go")); !strings.Contains(got, "\tdefer func() {\n\t\tif c.Response().Committed {\n") {
+		t.Errorf("deferred func not indented:\n%s", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "directives.go")); !strings.Contains(got, "// for the ctx\n\t\"context\"") {
+		t.Errorf("import comment lost:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestCompanion(t *testing.T) {
+	src := `package app
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+var called []string
+
+func GetUser(c echo.Context) error {
+	called = append(called, spanName(c.Request().Context()))
+	return c.NoContent(200)
+}
+
+func load(ctx context.Context, id int, _ string, tags ...string) (int, error) {
+	called = append(called, spanName(ctx))
+	return id + len(tags), nil
+}
+`
+	test := `package app
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestWrappers(t *testing.T) {
+	if n, err := tracedLoad(context.Background(), 1, "x", "a", "b"); n != 3 || err != nil {
+		t.Errorf("tracedLoad = %d, %v", n, err)
+	}
+	c := echo.NewContext(httptest.NewRequest("GET", "/users/1", nil))
+	if err := tracedGetUser(c); err != nil || c.Response().Status != 200 {
+		t.Errorf("tracedGetUser = %v, status %d", err, c.Response().Status)
+	}
+	// the originals run in the spans of the wrappers
+	if want := []string{"load", "GetUser"}; !slices.Equal(called, want) {
+		t.Errorf("called in spans %q, want %q", called, want)
+	}
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "a_test.go": test, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, Companion: true})
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != src {
+		t.Errorf("source modified:\n%s", got)
+	}
+	companion := readFile(t, filepath.Join(dir, "a_otel.go"))
+	for _, want := range []string{
+		"func tracedLoad(ctx context.Context, id int, p3 string, tags ...string) (int, error) {",
+		"return load(ctx, id, p3, tags...)",
+		"c.SetRequest(c.Request().WithContext(ctx))\n\treturn GetUser(c)",
+	} {
+		if !strings.Contains(companion, want) {
+			t.Errorf("companion lacks %q:\n%s", want, companion)
+		}
+	}
+	goCmd(t, dir, "test", "./...")
+}
+
+func TestOutputSuffix(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func One(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, OutputSuffix: "_traced"})
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != src {
+		t.Errorf("source modified:\n%s", got)
+	}
+	got := readFile(t, filepath.Join(dir, "a_traced.go"))
+	if want := generatedHeader + "//go:build otelspan\n\npackage app\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("generated file does not start with %q:\n%s", want, got)
+	}
+	if !strings.Contains(got, `tracer.Start(ctx, "One")`) {
+		t.Errorf("generated file not instrumented:\n%s", got)
+	}
+	build(t, dir)
+
+	run(t, dir, &Opts{Fix: true, OutputSuffix: "_traced", ExcludeSources: true})
+	if got := readFile(t, filepath.Join(dir, "a.go")); !strings.HasPrefix(got, "//go:build !otelspan\n\npackage app\n") {
+		t.Errorf("source not excluded:\n%s", got)
+	}
+	build(t, dir)
+	goCmd(t, dir, "vet", "-tags", generatedTag, "./...")
+}
+
+func TestAttributeAlias(t *testing.T) {
+	src := `package app
+
+import "context"
+
+//elephandog:trace-attr component=billing
+func Charge(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, Aliases: map[string]string{attributePkgPath: "otelattr"}})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	for _, want := range []string{`otelattr "` + attributePkgPath + `"`, `span.SetAttributes(otelattr.String("component", "billing"))`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q not generated:\n%s", want, got)
+		}
+	}
+	build(t, dir)
+}
+
+func TestMaxNesting(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Outer(ctx context.Context) error {
+	f := func(ctx context.Context) error {
+		g := func(ctx context.Context) error {
+			return nil
+		}
+		return g(ctx)
+	}
+	return f(ctx)
+}
+`
+	for depth, want := range map[int][]string{
+		0: {`"Outer"`},
+		1: {`"Outer"`, `"Outer.func1"`},
+		2: {`"Outer"`, `"Outer.func1"`, `"Outer.func1.1"`},
+	} {
+		dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+		run(t, dir, &Opts{Fix: true, MaxNesting: depth})
+		got := readFile(t, filepath.Join(dir, "a.go"))
+		if n := strings.Count(got, "tracer.Start("); n != len(want) {
+			t.Errorf("max nesting %d: %d spans, want %d:\n%s", depth, n, len(want), got)
+		}
+		for _, name := range want {
+			if !strings.Contains(got, "tracer.Start(ctx, "+name+")") {
+				t.Errorf("max nesting %d: no span %s:\n%s", depth, name, got)
+			}
+		}
+		build(t, dir)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func One(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, Backup: true})
+	if got := readFile(t, filepath.Join(dir, "a.go.orig")); got != src {
+		t.Errorf("backup differs from the source:\n%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tracer.go.orig")); !os.IsNotExist(err) {
+		t.Errorf("unchanged file backed up: %v", err)
+	}
+}
+
+func TestAlsoInstrumentModuleCache(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("GOMODCACHE", cache)
+	shared := `package shared
+
+import "context"
+
+func Load(ctx context.Context) error {
+	return nil
+}
+`
+	modDir := filepath.Join(cache, "example.com", "shared@v1.0.0")
+	writeFiles(t, modDir, map[string]string{"go.mod": "module example.com/shared\n\ngo 1.23\n", "shared.go": shared})
+	app := `package app
+
+import (
+	"context"
+
+	"example.com/shared"
+)
+
+func Run(ctx context.Context) error {
+	return shared.Load(ctx)
+}
+`
+	dir := testModule(t, map[string]string{"a.go": app, "tracer.go": tracerSrc})
+	gomod := readFile(t, filepath.Join(dir, "go.mod"))
+	gomod += "\nrequire example.com/shared v1.0.0\n\nreplace example.com/shared => " + modDir + "\n"
+	writeFiles(t, dir, map[string]string{"go.mod": gomod})
+
+	err := Run(context.Background(), dir, &Opts{Fix: true, AlsoInstrument: []string{"example.com/shared"}})
+	if err == nil || !strings.Contains(err.Error(), "module cache") {
+		t.Fatalf("got %v, want a module cache error", err)
+	}
+	if got := readFile(t, filepath.Join(modDir, "shared.go")); got != shared {
+		t.Errorf("module in the cache modified:\n%s", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != app {
+		t.Errorf("file written before failing:\n%s", got)
+	}
+}
+
+func TestNolint(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func One(ctx context.Context) error {
+	return nil
+}
+
+func Two(ctx context.Context) error { return nil }
+`
+	want := "\t_, span := tracer.Start(ctx, \"One\") //nolint:errcheck,spancheck\n\tdefer span.End()\n"
+	for _, opts := range []*Opts{
+		{Fix: true, Nolint: "errcheck,spancheck"},
+		{Fix: true, Nolint: "errcheck,spancheck", MinimalDiff: true},
+	} {
+		dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+		run(t, dir, opts)
+		got := readFile(t, filepath.Join(dir, "a.go"))
+		if !strings.Contains(got, want) {
+			t.Errorf("minimal diff %v: no commented span start:\n%s", opts.MinimalDiff, got)
+		}
+		if !strings.Contains(got, `tracer.Start(ctx, "Two") //nolint:errcheck,spancheck`+"\n") {
+			t.Errorf("minimal diff %v: one-line body not commented:\n%s", opts.MinimalDiff, got)
+		}
+		build(t, dir)
+	}
+}
+
+func TestMaxNestingFlags(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want int
+	}{
+		{args: nil, want: defaultMaxNesting},
+		{args: []string{"-max-nesting", "0"}, want: 0},
+		{args: []string{"-max-closure-depth", "2"}, want: 2},
+		// the last one wins, as both set the same option
+		{args: []string{"-max-nesting", "3", "-max-closure-depth", "0"}, want: 0},
+	} {
+		fs := flag.NewFlagSet("otelspan", flag.ContinueOnError)
+		var maxNesting int
+		maxNestingFlags(fs, &maxNesting)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if maxNesting != tt.want {
+			t.Errorf("%v: max nesting %d, want %d", tt.args, maxNesting, tt.want)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	src := `package app
+
+import (
+	"context"
+	"errors"
+
+	"github.com/labstack/echo/v4"
+)
+
+//elephandog:trace-attr component=billing
+func Charge(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("no ctx")
+	}
+	return nil
+}
+
+func Get(c echo.Context) error {
+	return c.NoContent(500)
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, WrapBody: true, StatusFromResponse: true, Aliases: map[string]string{
+		attributePkgPath: "otelattr",
+		codesPkgPath:     "otelcodes",
+	}})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	for _, want := range []string{
+		`otelattr "` + attributePkgPath + `"`,
+		`otelcodes "` + codesPkgPath + `"`,
+		`span.SetAttributes(otelattr.String("component", "billing"))`,
+		`span.SetStatus(otelcodes.Error, err.Error())`,
+		`span.SetStatus(otelcodes.Error, "")`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q not generated:\n%s", want, got)
+		}
+	}
+	// spans are only referred to through the tracer, so the trace package needs no alias
+	if strings.Contains(got, "go.opentelemetry.io/otel/trace") {
+		t.Errorf("trace package imported:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestIncludeTests(t *testing.T) {
+	helper := func(name string) string {
+		return `package app
+
+import (
+	"context"
+	"testing"
+)
+
+func ` + name + `(ctx context.Context) error {
+	return nil
+}
+
+func Test` + name + `(t *testing.T) {
+	if err := ` + name + `(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+`
+	}
+	files := map[string]string{
+		"integration_users_test.go": helper("LoadUsers"),
+		"unit_test.go":              helper("LoadUnit"),
+		"tracer.go":                 tracerSrc,
+	}
+	for pattern, instrumented := range map[string][]string{
+		"":                      nil,
+		"integration_*_test.go": {"integration_users_test.go"},
+	} {
+		dir := testModule(t, files)
+		run(t, dir, &Opts{Fix: true, IncludeTests: pattern})
+		for _, name := range []string{"integration_users_test.go", "unit_test.go"} {
+			got := readFile(t, filepath.Join(dir, name))
+			if want := slices.Contains(instrumented, name); strings.Contains(got, "tracer.Start(") != want {
+				t.Errorf("pattern %q: %s instrumented = %t, want %t:\n%s", pattern, name, !want, want, got)
+			}
+		}
+		goCmd(t, dir, "test", "./...")
+	}
+}
+
+func TestExistingStart(t *testing.T) {
+	helped := `func Helped(ctx context.Context) error {
+	ctx, span := StartSpan(ctx, "helped")
+	defer span.End()
+	return load(ctx)
+}`
+	src := `package app
+
+import "context"
+
+//elephandog:ignore-trace
+func StartSpan(ctx context.Context, name string) (context.Context, fakeSpan) {
+	return tracer.Start(ctx, name)
+}
+
+` + helped + `
+
+func Deferred(ctx context.Context) error {
+	// calls in function literals do not count
+	start := func() { StartSpan(ctx, "later") }
+	start()
+	return nil
+}
+
+//elephandog:ignore-trace
+func load(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, ExistingStart: regexp.MustCompile(`^StartSpan$`)})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	if !strings.Contains(got, helped) {
+		t.Errorf("function starting a span with the helper modified:\n%s", got)
+	}
+	if !strings.Contains(got, `tracer.Start(ctx, "Deferred")`) {
+		t.Errorf("function calling the helper in a function literal not instrumented:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestTracerFunc(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Load(ctx context.Context) error {
+	return nil
+}
+`
+	tracing := `package tracing
+
+import "context"
+
+type Span struct{}
+
+func (Span) End() {}
+
+type T struct{}
+
+func (T) Start(ctx context.Context, name string) (context.Context, Span) { return ctx, Span{} }
+
+func Tracer(pkg string) T { return T{} }
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracing/tracing.go": tracing})
+	run(t, dir, &Opts{Fix: true, TracerFunc: "tracing.Tracer", TracerImport: "example.com/app/tracing"})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	for _, want := range []string{`"example.com/app/tracing"`, `_, span := tracing.Tracer("example.com/app").Start(ctx, "Load")`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q not generated:\n%s", want, got)
+		}
+	}
+	if got := readFile(t, filepath.Join(dir, "tracing/tracing.go")); got != tracing {
+		t.Errorf("tracer package instrumented:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestSince(t *testing.T) {
+	src := func(name string) string {
+		return `package app
+
+import "context"
+
+func ` + name + `(ctx context.Context) error {
+	return nil
+}
+`
+	}
+	dir := testModule(t, map[string]string{"a.go": src("A"), "b.go": src("B"), "tracer.go": tracerSrc})
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	// changed after the commit, but not committed
+	changed := src("B") + "\nfunc C(ctx context.Context) error {\n\treturn nil\n}\n"
+	writeFiles(t, dir, map[string]string{"b.go": changed})
+	run(t, dir, &Opts{Fix: true, Since: "HEAD"})
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != src("A") {
+		t.Errorf("unchanged file instrumented:\n%s", got)
+	}
+	got := readFile(t, filepath.Join(dir, "b.go"))
+	for _, name := range []string{"B", "C"} {
+		if !strings.Contains(got, `tracer.Start(ctx, "`+name+`")`) {
+			t.Errorf("%s of the changed file not instrumented:\n%s", name, got)
+		}
+	}
+	build(t, dir)
+}
+
+func TestRequireTracer(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Load(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src})
+	err := Run(context.Background(), dir, &Opts{Fix: true, RequireTracer: true})
+	if err == nil || !strings.Contains(err.Error(), "packages have no tracer var: example.com/app") {
+		t.Fatalf("got %v, want example.com/app reported", err)
+	}
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != src {
+		t.Errorf("package without a tracer var modified:\n%s", got)
+	}
+	writeFiles(t, dir, map[string]string{"tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, RequireTracer: true})
+	if got := readFile(t, filepath.Join(dir, "a.go")); !strings.Contains(got, `tracer.Start(ctx, "Load")`) {
+		t.Errorf("package with a tracer var not instrumented:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestCheckCtx(t *testing.T) {
+	src := `package app
+
+import (
+	"context"
+	"time"
+)
+
+//elephandog:ignore-trace
+func load(ctx context.Context) error {
+	return nil
+}
+
+func Background(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Background")
+	defer span.End()
+	return load(context.Background())
+}
+
+func TODO(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "TODO")
+	defer span.End()
+	return load(context.TODO())
+}
+
+func Shadowed(parent context.Context) error {
+	ctx, span := tracer.Start(parent, "Shadowed")
+	defer span.End()
+	if err := load(ctx); err != nil {
+		return err
+	}
+	{
+		// derived from the span's ctx, so in the span
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		if err := load(ctx); err != nil {
+			return err
+		}
+	}
+	{
+		// not in the span
+		ctx := context.WithoutCancel(parent)
+		return load(ctx)
+	}
+}
+
+func Discarded(ctx context.Context) error {
+	_, span := tracer.Start(ctx, "Discarded")
+	defer span.End()
+	return load(ctx)
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	out, err := runErr(t, dir, &Opts{CheckCtx: true})
+	if err == nil || err.Error() != "5 calls do not pass the ctx of the span" {
+		t.Errorf("got %v, want 5 calls reported", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	want := []string{
+		"a.go:16:14: call to load passes context.Background() instead of the span's ctx",
+		"a.go:22:14: call to load passes context.TODO() instead of the span's ctx",
+		"a.go:41:32: call to context.WithoutCancel passes parent which is not in the span",
+		"a.go:42:15: call to load passes ctx which is not in the span",
+		"a.go:49:14: call to load passes ctx which is not in the span",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got findings:\n%s\nwant:\n%s", out, strings.Join(want, "\n"))
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, want[i]) {
+			t.Errorf("finding %d: got %q, want %q", i, line, want[i])
+		}
+	}
+}
+
+func TestReachableFromRoutes(t *testing.T) {
+	src := `package app
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+)
+
+func Register(e *echo.Echo) {
+	e.GET("/users/:id", GetUser)
+}
+
+func GetUser(c echo.Context) error {
+	if err := loadUser(c.Request().Context()); err != nil {
+		return err
+	}
+	return c.NoContent(200)
+}
+
+func loadUser(ctx context.Context) error {
+	return loadTeam(ctx)
+}
+
+func loadTeam(ctx context.Context) error {
+	return nil
+}
+
+// Unused is not called by any handler.
+func Unused(ctx context.Context) error {
+	return loadTeam(ctx)
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, ReachableFromRoutes: true})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	for _, name := range []string{"GetUser", "loadUser", "loadTeam"} {
+		if !strings.Contains(got, `tracer.Start(ctx, "`+name+`")`) {
+			t.Errorf("reachable %s not instrumented:\n%s", name, got)
+		}
+	}
+	if strings.Contains(got, `"Unused"`) {
+		t.Errorf("unreachable Unused instrumented:\n%s", got)
+	}
+	if !strings.Contains(got, "// Unused is not called by any handler.\nfunc Unused") {
+		t.Errorf("doc comment moved off Unused:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestBuildTargets(t *testing.T) {
+	variant := func(goos string) string {
+		return `package app
+
+import "context"
+
+func Open` + goos + `(ctx context.Context) error {
+	return nil
+}
+`
+	}
+	files := map[string]string{"a_linux.go": variant("Linux"), "a_windows.go": variant("Windows"), "tracer.go": tracerSrc}
+	for _, tt := range []struct {
+		name    string
+		goos    []string
+		windows bool
+	}{
+		{"host", []string{"linux"}, false},
+		{"matrix", []string{"linux", "windows"}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, files)
+			run(t, dir, &Opts{Fix: true, GOOS: tt.goos, GOARCH: []string{"amd64"}})
+			if got := readFile(t, filepath.Join(dir, "a_linux.go")); !strings.Contains(got, `tracer.Start(ctx, "OpenLinux")`) {
+				t.Errorf("linux variant not instrumented:\n%s", got)
+			}
+			got := readFile(t, filepath.Join(dir, "a_windows.go"))
+			if instrumented := strings.Contains(got, `tracer.Start(ctx, "OpenWindows")`); instrumented != tt.windows {
+				t.Errorf("windows variant instrumented = %v, want %v:\n%s", instrumented, tt.windows, got)
+			}
+			build(t, dir)
+		})
+	}
+}
+
+func TestHandlerVars(t *testing.T) {
+	src := `package app
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+var getUser echo.HandlerFunc = func(c echo.Context) error {
+	return c.NoContent(200)
+}
+
+func Register(e *echo.Echo) {
+	var health http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}
+	http.Handle("/health", health)
+	e.GET("/users/:id", getUser)
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true})
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != src {
+		t.Errorf("handler vars instrumented without -handler-vars:\n%s", got)
+	}
+	run(t, dir, &Opts{Fix: true, HandlerVars: true})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	for _, want := range []string{
+		"ctx := c.Request().Context()\n\t_, span := tracer.Start(ctx, \"getUser\")",
+		"ctx := r.Context()\n\t\t_, span := tracer.Start(ctx, \"health\")",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q:\n%s", want, got)
+		}
+	}
+	build(t, dir)
+}
+
+func TestDisabledPackage(t *testing.T) {
+	a := `// Package app is instrumented by hand.
+//
+// otelspan:disable
+package app
+
+import "context"
+
+func Load(ctx context.Context) error {
+	return nil
+}
+`
+	b := `package app
+
+import "context"
+
+func Save(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": a, "b.go": b, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true})
+	for name, want := range map[string]string{"a.go": a, "b.go": b} {
+		if got := readFile(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("%s of the disabled package modified:\n%s", name, got)
+		}
+	}
+}
+
+func TestFrameworkMismatch(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Load(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	logs := capture(t, &os.Stderr, func() {
+		run(t, dir, &Opts{Framework: "echo"})
+	})
+	if !strings.Contains(logs, "level=WARN") || !strings.Contains(logs, "of framework echo") {
+		t.Errorf("no warning about the framework:\n%s", logs)
+	}
+	var err error
+	capture(t, &os.Stderr, func() {
+		_, err = runErr(t, dir, &Opts{Framework: "echo", Strict: true})
+	})
+	if err == nil || !strings.Contains(err.Error(), "of framework echo") {
+		t.Errorf("got %v, want an error with -strict", err)
+	}
+
+	writeFiles(t, dir, map[string]string{"b.go": `package app
+
+import "github.com/labstack/echo/v4"
+
+func GetUser(c echo.Context) error {
+	return nil
+}
+`})
+	if logs := capture(t, &os.Stderr, func() {
+		run(t, dir, &Opts{Framework: "echo", Strict: true})
+	}); strings.Contains(logs, "of framework echo") {
+		t.Errorf("warned though echo is imported:\n%s", logs)
+	}
+}
+
+func TestCoverageOut(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Load(ctx context.Context) error {
+	f := func(ctx context.Context) error {
+		return nil
+	}
+	return f(ctx)
+}
+
+func Save(ctx context.Context) error {
+	_, span := tracer.Start(ctx, "Save")
+	defer span.End()
+	return nil
+}
+
+func helper() {}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	out := filepath.Join(t.TempDir(), "coverage.json")
+	run(t, dir, &Opts{MaxNesting: 1, CoverageOut: out})
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != src {
+		t.Errorf("modified without -fix:\n%s", got)
+	}
+	var got Coverage
+	if err := json.Unmarshal([]byte(readFile(t, out)), &got); err != nil {
+		t.Fatal(err)
+	}
+	// Load.func1 is covered first, but listed in source order after Load; the funcs of
+	// tracer.go taking ctx are covered too
+	want := []*CoveredFunc{
+		{Filename: "a.go", Line: 5, Func: "Load"},
+		{Filename: "a.go", Line: 6, Func: "Load.func1"},
+		{Filename: "a.go", Line: 12, Func: "Save", Traced: true},
+	}
+	funcs := slices.DeleteFunc(slices.Clone(got.Funcs), func(f *CoveredFunc) bool {
+		return f.Filename != "a.go"
+	})
+	if got.Total != len(got.Funcs) || got.Traced != 1 || !slices.EqualFunc(funcs, want, func(a, b *CoveredFunc) bool {
+		return *a == *b
+	}) {
+		b, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("got coverage:\n%s", b)
+	}
+}
+
+func TestReportUnusedHandlers(t *testing.T) {
+	src := `package app
+
+import "github.com/labstack/echo/v4"
+
+func Register(e *echo.Echo) {
+	e.GET("/users/:id", GetUser)
+}
+
+func GetUser(c echo.Context) error {
+	return nil
+}
+
+func DeleteUser(c echo.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	out, err := runErr(t, dir, &Opts{Fix: true, ReportUnusedHandlers: true})
+	if err == nil || !strings.Contains(err.Error(), "1 handlers") {
+		t.Errorf("got %v, want 1 unused handler", err)
+	}
+	if !strings.Contains(out, "a.go:13:1: handler example.com/app.DeleteUser is not registered to any route") || strings.Contains(out, "GetUser") {
+		t.Errorf("want only DeleteUser reported:\n%s", out)
+	}
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != src {
+		t.Errorf("modified while reporting:\n%s", got)
+	}
+}
+
+func TestCustomContext(t *testing.T) {
+	src := `package app
+
+import "context"
+
+type AppContext struct {
+	context.Context
+	UserID int
+}
+
+func Load(actx AppContext) error {
+	return nil
+}
+
+func Save(ctx *AppContext) error {
+	return nil
+}
+
+func Count(n int) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, PropagateCtx: true})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	for _, want := range []string{
+		"func Load(actx AppContext) error {\n\t_, span := tracer.Start(actx, \"Load\")",
+		// a custom context cannot be assigned the context.Context Start returns
+		"func Save(ctx *AppContext) error {\n\t_, span := tracer.Start(ctx, \"Save\")",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `"Count"`) {
+		t.Errorf("func without a context instrumented:\n%s", got)
+	}
+	build(t, dir)
+}
+
+func TestQuiet(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Load(ctx context.Context) error {
+	return nil
+}
+
+func Count(n int) error {
+	return nil
+}
+`
+	for _, quiet := range []bool{false, true} {
+		dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+		// as set by -quiet
+		opts := &Opts{Fix: true, LogLevel: slog.LevelInfo}
+		if quiet {
+			opts.Quiet, opts.LogLevel = true, slog.LevelError
+		}
+		var out string
+		logs := capture(t, &os.Stderr, func() {
+			out = run(t, dir, opts)
+		})
+		if quiet && (out != "" || logs != "") {
+			t.Errorf("quiet run printed\nstdout:\n%s\nstderr:\n%s", out, logs)
+		}
+		if !quiet && out == "" {
+			t.Error("no summary printed without -quiet")
+		}
+		if got := readFile(t, filepath.Join(dir, "a.go")); !strings.Contains(got, `tracer.Start(ctx, "Load")`) {
+			t.Errorf("quiet=%v: not instrumented:\n%s", quiet, got)
+		}
+	}
+}
+
+func TestStatusFromResponse(t *testing.T) {
+	src := `package app
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func GetUser(c echo.Context) error {
+	return c.JSON(http.StatusOK, nil)
+}
+
+func DeleteUser(c echo.Context) error {
+	return c.NoContent(http.StatusInternalServerError)
+}
+
+func UpdateUser(c echo.Context) error {
+	return c.NoContent(statusFor(c.QueryParam("fail") != ""))
+}
+
+func statusFor(fail bool) int {
+	if fail {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+func Health(c echo.Context) error {
+	return nil
+}
+`
+	test := `package app
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		handler  echo.HandlerFunc
+		target   string
+		attrs    []attribute.KeyValue
+		statuses []codes.Code
+	}{
+		{"GetUser", GetUser, "/", []attribute.KeyValue{attribute.Int("http.response.status_code", 200)}, nil},
+		{"DeleteUser", DeleteUser, "/", []attribute.KeyValue{attribute.Int("http.response.status_code", 500)}, []codes.Code{codes.Error}},
+		{"UpdateUser", UpdateUser, "/", []attribute.KeyValue{attribute.Int("http.response.status_code", 200)}, nil},
+		{"UpdateUser", UpdateUser, "/?fail=1", []attribute.KeyValue{attribute.Int("http.response.status_code", 503)}, []codes.Code{codes.Error}},
+	} {
+		recordedAttrs, recordedStatuses = nil, nil
+		c := echo.NewContext(httptest.NewRequest("GET", tt.target, nil))
+		if err := tt.handler(c); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(recordedAttrs, tt.attrs) {
+			t.Errorf("%s %s: attributes %v, want %v", tt.name, tt.target, recordedAttrs, tt.attrs)
+		}
+		if !slices.Equal(recordedStatuses, tt.statuses) {
+			t.Errorf("%s %s: statuses %v, want %v", tt.name, tt.target, recordedStatuses, tt.statuses)
+		}
+	}
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "a_test.go": test, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, StatusFromResponse: true})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	// only the handlers writing a response record its status
+	if n := strings.Count(got, "c.Response().Committed"); n != 3 {
+		t.Errorf("%d handlers record the status, want 3:\n%s", n, got)
+	}
+	goCmd(t, dir, "test", "./...")
+}
+
+func TestPostFormat(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Load(ctx context.Context) error {
+	return nil
+}
+`
+	bin := t.TempDir()
+	// the stub logs the dir it runs in and marks what it formats
+	stub := filepath.Join(bin, "stubfmt")
+	writeFiles(t, bin, map[string]string{
+		"stubfmt": "#!/bin/sh\npwd >> \"$1\"\necho '// formatted'\ncat\n",
+		"failfmt": "#!/bin/sh\necho 'syntax error' >&2\nexit 1\n",
+	})
+	for _, name := range []string{"stubfmt", "failfmt"} {
+		if err := os.Chmod(filepath.Join(bin, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	logFile := filepath.Join(bin, "log")
+	run(t, dir, &Opts{Fix: true, PostFormat: stub + " " + logFile})
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	if !strings.HasPrefix(got, "// formatted\npackage app") || !strings.Contains(got, `tracer.Start(ctx, "Load")`) {
+		t.Errorf("changed file not formatted:\n%s", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "tracer.go")); got != tracerSrc {
+		t.Errorf("unchanged file formatted:\n%s", got)
+	}
+	// once for a.go, in its dir
+	if got := readFile(t, logFile); got != dir+"\n" {
+		t.Errorf("formatter ran in %q, want once in %s", got, dir)
+	}
+
+	dir = testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	_, err := runErr(t, dir, &Opts{Fix: true, PostFormat: filepath.Join(bin, "failfmt")})
+	if err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("got %v, want the formatter error", err)
+	}
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != src {
+		t.Errorf("written though the formatter failed:\n%s", got)
+	}
+}
+
+func TestCommentsKept(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Load(ctx context.Context) error { // loads
+	// nothing to load
+	return nil
+}
+
+// Save is documented.
+func Save(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true})
+	want := `package app
+
+import "context"
+
+func Load(ctx context.Context) error { // loads
+	_, span := tracer.Start(ctx, "Load")
+	defer span.End()
+	// nothing to load
+	return nil
+}
+
+// Save is documented.
+func Save(ctx context.Context) error {
+	_, span := tracer.Start(ctx, "Save")
+	defer span.End()
+	return nil
+}
+`
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWrapBodyComments(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Load(ctx context.Context) error {
+	// nothing to load
+	return nil // yet
+	// unreachable
+}
+
+// Save is documented.
+func Save(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	run(t, dir, &Opts{Fix: true, WrapBody: true})
+	want := `package app
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func Load(ctx context.Context) error {
+	_, span := tracer.Start(ctx, "Load")
+	defer span.End()
+	err := func() error {
+		// nothing to load
+		return nil // yet
+		// unreachable
+	}()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Save is documented.
+func Save(ctx context.Context) error {
+	_, span := tracer.Start(ctx, "Save")
+	defer span.End()
+	err := func() error {
+		return nil
+	}()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+`
+	if got := readFile(t, filepath.Join(dir, "a.go")); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	build(t, dir)
+}
+
+func TestLogMode(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func Load(ctx context.Context) error {
+	return nil
+}
+`
+	for _, tt := range []struct {
+		name string
+		opts *Opts
+		want string
+	}{
+		{"default", &Opts{Fix: true, Mode: modeLog}, `package app
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+func Load(ctx context.Context) error {
+	defer func(start time.Time) {
+		log.Printf("%s took %s", "Load", time.Since(start))
+	}(time.Now())
+	return nil
+}
+`},
+		{"log func", &Opts{Fix: true, Mode: modeLog, LogFunc: "logger.Debugf", LogImport: "example.com/app/logger"}, `package app
+
+import (
+	"context"
+	"example.com/app/logger"
+	"time"
+)
+
+func Load(ctx context.Context) error {
+	defer func(start time.Time) {
+		logger.Debugf("%s took %s", "Load", time.Since(start))
+	}(time.Now())
+	return nil
+}
+`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, map[string]string{
+				"a.go":             src,
+				"logger/logger.go": "package logger\n\nimport \"log\"\n\nfunc Debugf(format string, args ...any) { log.Printf(format, args...) }\n",
+			})
+			run(t, dir, tt.opts)
+			if got := readFile(t, filepath.Join(dir, "a.go")); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			// instrumented functions are left as is
+			run(t, dir, tt.opts)
+			if got := readFile(t, filepath.Join(dir, "a.go")); got != tt.want {
+				t.Errorf("second run changed the file:\n%s", got)
+			}
+			build(t, dir)
+		})
+	}
+}
+
+func TestInteractive(t *testing.T) {
+	src := `package app
+
+import "context"
+
+func One(ctx context.Context) error {
+	return nil
+}
+
+func Two(ctx context.Context) error {
+	return nil
+}
+
+func Three(ctx context.Context) error {
+	return nil
+}
+`
+	dir := testModule(t, map[string]string{"a.go": src, "tracer.go": tracerSrc})
+	// the input runs out before Three is asked about
+	prompts := capture(t, &os.Stderr, func() {
+		run(t, dir, &Opts{Fix: true, Interactive: true, Stdin: strings.NewReader("y\nn\n")})
+	})
+	for _, prompt := range []string{"a.go:5:1: instrument One? [y/N] ", "instrument Two? [y/N] ", "instrument Three? [y/N] "} {
+		if !strings.Contains(prompts, prompt) {
+			t.Errorf("not asked %q:\n%s", prompt, prompts)
+		}
+	}
+	got := readFile(t, filepath.Join(dir, "a.go"))
+	if strings.Count(got, "tracer.Start(") != 1 || !strings.Contains(got, `tracer.Start(ctx, "One")`) {
+		t.Errorf("want only One instrumented:\n%s", got)
+	}
+	build(t, dir)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// parseMembers are the members of echo.Context and *http.Request reading the request args, whose
+// calls lead the body of a handler parsing them, e.g. c.Param, c.Bind or r.URL.Query.
+var parseMembers = map[string]bool{
+	// echo.Context
+	"Bind":          true,
+	"Cookie":        true,
+	"Cookies":       true,
+	"FormFile":      true,
+	"FormParams":    true,
+	"FormValue":     true,
+	"Param":         true,
+	"ParamNames":    true,
+	"ParamValues":   true,
+	"QueryParam":    true,
+	"QueryParams":   true,
+	"QueryString":   true,
+	"RealIP":        true,
+	"Validate":      true,
+	"MultipartForm": true,
+	// *http.Request
+	"Header":             true,
+	"ParseForm":          true,
+	"ParseMultipartForm": true,
+	"PathValue":          true,
+	"PostFormValue":      true,
+	"URL":                true,
+}
+
+// parseEnd returns the index of the first statement of body after the leading ones parsing the
+// request args through param, the echo.Context or *http.Request of the handler:
+//
+//	id := c.Param("id")
+//	var req UpdateRequest
+//	if err := c.Bind(&req); err != nil {
+//		return echo.NewHTTPError(http.StatusBadRequest, err)
+//	}
+//	n, err := strconv.Atoi(c.QueryParam("n"))
+//	if err != nil {
+//		return err
+//	}
+//
+// Statements only calling strconv functions and checks returning early belong to the block when
+// they follow a statement calling param.
+func parseEnd(body []ast.Stmt, param string) int {
+	if param == "" {
+		return 0
+	}
+	for i, stmt := range body {
+		if !isParseStmt(stmt, param, i > 0) {
+			return i
+		}
+	}
+	return len(body)
+}
+
+func isParseStmt(stmt ast.Stmt, param string, inBlock bool) bool {
+	switch x := stmt.(type) {
+	case *ast.DeclStmt:
+		// var req UpdateRequest
+		gen, ok := x.Decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			return false
+		}
+		for _, spec := range gen.Specs {
+			if vs, ok := spec.(*ast.ValueSpec); !ok || len(vs.Values) > 0 {
+				return false
+			}
+		}
+		return true
+	case *ast.AssignStmt:
+		// the ctx the span is started from is assigned after the block
+		for _, lhs := range x.Lhs {
+			if isIdent(lhs, "ctx") {
+				return false
+			}
+		}
+		return parsesArgs(x, param, inBlock)
+	case *ast.ExprStmt:
+		return parsesArgs(x, param, inBlock)
+	case *ast.IfStmt:
+		if x.Else != nil || len(x.Body.List) == 0 {
+			return false
+		}
+		if _, ok := x.Body.List[len(x.Body.List)-1].(*ast.ReturnStmt); !ok {
+			return false
+		}
+		if x.Init != nil {
+			return isParseStmt(x.Init, param, inBlock) && callsOnly(x.Cond, param)
+		}
+		return inBlock && callsOnly(x.Cond, param)
+	}
+	return false
+}
+
+// parsesArgs reports whether node calls param to parse the args, or strconv functions inBlock,
+// and nothing else.
+func parsesArgs(node ast.Node, param string, inBlock bool) bool {
+	if !callsOnly(node, param) {
+		return false
+	}
+	if inBlock {
+		return true
+	}
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && parseCall(call, param) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// callsOnly reports whether every call in node is a parseCall on param or to a strconv function.
+func callsOnly(node ast.Node, param string) bool {
+	ok := true
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			ok = false
+		case *ast.CallExpr:
+			if sel, isSel := x.Fun.(*ast.SelectorExpr); isSel && isIdent(sel.X, "strconv") {
+				break
+			}
+			if !parseCall(x, param) {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok
+}
+
+// parseCall reports whether call is a method call on a parseMembers member of param, like
+// c.Param("id"), c.QueryParams().Get("q") or r.URL.Query().
+func parseCall(call *ast.CallExpr, param string) bool {
+	expr := call.Fun
+	for {
+		switch x := expr.(type) {
+		case *ast.SelectorExpr:
+			if isIdent(x.X, param) {
+				return parseMembers[x.Sel.Name]
+			}
+			expr = x.X
+		case *ast.CallExpr:
+			expr = x.Fun
+		default:
+			return false
+		}
+	}
+}
+
+// handlerParam returns the param of the handler the request args are parsed through: c for an
+// echo handler, or else the *http.Request param of an http.HandlerFunc.
+func handlerParam(ftype *ast.FuncType) string {
+	if echoVar, ok := tracedParam(ftype); ok && echoVar {
+		return "c"
+	}
+	return httpRequestParam(ftype)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// reachableFuncs returns the functions, keyed by types.Func.FullName, transitively called from
+// the handlers of routes according to the class hierarchy call graph of pkgs. A function literal
+// makes the function declaring it reachable.
+func reachableFuncs(pkgs []*packages.Package, routes map[string]string) map[string]bool {
+	prog, _ := ssautil.Packages(pkgs, ssa.InstantiateGenerics)
+	prog.Build()
+	cg := cha.CallGraph(prog)
+
+	var queue []*callgraph.Node
+	visited := map[*callgraph.Node]bool{}
+	for fn, node := range cg.Nodes {
+		if name, ok := funcName(fn); ok && routes[name] != "" {
+			queue = append(queue, node)
+			visited[node] = true
+		}
+	}
+	reachable := map[string]bool{}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if name, ok := funcName(node.Func); ok {
+			reachable[name] = true
+		}
+		for _, edge := range node.Out {
+			if !visited[edge.Callee] {
+				visited[edge.Callee] = true
+				queue = append(queue, edge.Callee)
+			}
+		}
+	}
+	return reachable
+}
+
+// funcName returns the full name of the declared function fn is or is nested in.
+func funcName(fn *ssa.Function) (string, bool) {
+	if fn == nil {
+		return "", false
+	}
+	for fn.Parent() != nil {
+		fn = fn.Parent()
+	}
+	if origin := fn.Origin(); origin != nil {
+		fn = origin
+	}
+	obj, ok := fn.Object().(*types.Func)
+	if !ok {
+		return "", false
+	}
+	return obj.FullName(), true
+}
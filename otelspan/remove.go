@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// removeSpans deletes span statements in the shape otelspan generates from every function in f:
+// `_, span := <tracer>.Start(ctx, "name")`, or `ctx, span :=` with -capture-ctx or -propagate-ctx, immediately followed by `defer span.End()`, and for
+// functions with a trace-attr directive or handlers with -route-attr a `span.SetAttributes(...)` right after them,
+// followed by the deferred func of -status-from-response. The ctx := assignment preceding the span
+// start, as generated for handlers, is removed too unless ctx is used otherwise.
+// Functions using the span otherwise, e.g. adding events, are left intact with a warning.
+// Comments on the lines of removed statements are dropped. It returns the number of removed statements.
+func removeSpans(ctx context.Context, fset *token.FileSet, f *ast.File) int {
+	removedLines := map[int]bool{}
+	var removed int
+	ast.Inspect(f, func(n ast.Node) bool {
+		var body *ast.BlockStmt
+		var attrs bool
+		switch x := n.(type) {
+		case *ast.FuncDecl:
+			body = x.Body
+			attrs = hasTraceAttrDirective(x.Doc)
+		case *ast.FuncLit:
+			body = x.Body
+		}
+		if body == nil {
+			return true
+		}
+		for i := 0; i+1 < len(body.List); i++ {
+			if !isSpanStart(body.List[i]) || !isSpanEnd(body.List[i+1]) {
+				continue
+			}
+			end := i + 2
+			if end < len(body.List) && isSetAttributes(body.List[end]) && (attrs || setsAttr(body.List[end], routeAttrKey)) {
+				end++
+			}
+			if end < len(body.List) && isStatusStmt(body.List[end]) {
+				end++
+			}
+			if pos, ok := usesSpan(body.List[end:]); ok {
+				slog.WarnContext(ctx, "span is used besides the generated statements, not removing", slog.String("pos", fset.Position(pos).String()))
+				break
+			}
+			start := i
+			startCall := body.List[i].(*ast.AssignStmt).Rhs[0].(*ast.CallExpr)
+			if i > 0 && isIdent(startCall.Args[0], "ctx") && isCtxAssign(body.List[i-1]) && !usesIdent(body.List[end:], "ctx") {
+				start = i - 1
+			}
+			for _, stmt := range body.List[start:end] {
+				// the deferred func of -status-from-response spans several lines
+				for line := fset.Position(stmt.Pos()).Line; line <= fset.Position(stmt.End()).Line; line++ {
+					removedLines[line] = true
+				}
+			}
+			removed += end - start
+			body.List = slices.Delete(body.List, start, end)
+			break
+		}
+		return true
+	})
+	if removed == 0 {
+		return 0
+	}
+	f.Comments = slices.DeleteFunc(f.Comments, func(cg *ast.CommentGroup) bool {
+		return removedLines[fset.Position(cg.Pos()).Line]
+	})
+	// merge the now empty lines into the following ones so that the printer does not keep blank lines
+	lines := slices.Sorted(maps.Keys(removedLines))
+	tf := fset.File(f.Pos())
+	for _, line := range slices.Backward(lines) {
+		if line < tf.LineCount() {
+			tf.MergeLine(line)
+		}
+	}
+	return removed
+}
+
+// usesSpan reports the first use of the span var in stmts, skipping function literals starting their own.
+func usesSpan(stmts []ast.Stmt) (token.Pos, bool) {
+	var pos token.Pos
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if pos.IsValid() {
+				return false
+			}
+			switch x := n.(type) {
+			case *ast.FuncLit:
+				return !slices.ContainsFunc(x.Body.List, isSpanStart)
+			case *ast.Ident:
+				if x.Name == "span" {
+					pos = x.Pos()
+				}
+			}
+			return true
+		})
+		if pos.IsValid() {
+			return pos, true
+		}
+	}
+	return token.NoPos, false
+}
+
+// usesIdent reports whether an identifier named name appears in stmts.
+func usesIdent(stmts []ast.Stmt, name string) bool {
+	found := false
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && ident.Name == name {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// isCtxAssign reports whether stmt is `ctx := <expr>`, like the one generated for handlers.
+func isCtxAssign(stmt ast.Stmt) bool {
+	assign, ok := stmt.(*ast.AssignStmt)
+	return ok && assign.Tok == token.DEFINE && len(assign.Lhs) == 1 && len(assign.Rhs) == 1 && isIdent(assign.Lhs[0], "ctx")
+}
+
+func hasTraceAttrDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	return slices.ContainsFunc(doc.List, func(c *ast.Comment) bool {
+		return strings.HasPrefix(c.Text, traceAttrDirective)
+	})
+}
+
+func isSpanStart(stmt ast.Stmt) bool {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != 2 || len(assign.Rhs) != 1 {
+		return false
+	}
+	if !(isIdent(assign.Lhs[0], "_") || isIdent(assign.Lhs[0], "ctx")) || !isIdent(assign.Lhs[1], "span") {
+		return false
+	}
+	call, ok := assign.Rhs[0].(*ast.CallExpr)
+	if !ok || len(call.Args) != 2 {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Start" {
+		return false
+	}
+	// ctx, or the param of a custom context type
+	if _, ok := call.Args[0].(*ast.Ident); !ok {
+		return false
+	}
+	lit, ok := call.Args[1].(*ast.BasicLit)
+	return ok && lit.Kind == token.STRING
+}
+
+func isSpanEnd(stmt ast.Stmt) bool {
+	d, ok := stmt.(*ast.DeferStmt)
+	return ok && isSpanCall(d.Call, "End") && len(d.Call.Args) == 0
+}
+
+func isSetAttributes(stmt ast.Stmt) bool {
+	e, ok := stmt.(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	call, ok := e.X.(*ast.CallExpr)
+	return ok && isSpanCall(call, "SetAttributes")
+}
+
+// setsAttr reports whether the span.SetAttributes(...) stmt sets the attribute key.
+func setsAttr(stmt ast.Stmt, key string) bool {
+	call := stmt.(*ast.ExprStmt).X.(*ast.CallExpr)
+	return slices.ContainsFunc(call.Args, func(arg ast.Expr) bool {
+		attr, ok := arg.(*ast.CallExpr)
+		if !ok || len(attr.Args) == 0 {
+			return false
+		}
+		lit, ok := attr.Args[0].(*ast.BasicLit)
+		return ok && lit.Value == strconv.Quote(key)
+	})
+}
+
+func isSpanCall(call *ast.CallExpr, method string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && isIdent(sel.X, "span") && sel.Sel.Name == method
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
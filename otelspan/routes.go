@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+const echoPkgPath = "github.com/labstack/echo/v4"
+
+// routeAttrKey is the attribute set to the path of the route of a handler by -route-attr.
+const routeAttrKey = "http.route"
+
+var echoRouteMethods = map[string]bool{
+	"GET":     true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"CONNECT": true,
+	"TRACE":   true,
+	"Any":     true,
+}
+
+// collectRoutes maps handler functions, keyed by types.Func.FullName, to the first echo route
+// they are registered to, like "GET /users/:id". Group prefixes are not followed. Entries of
+// route tables registered in a loop, like {http.MethodGet, "/users/:id", getUser}, count as
+// routes too, registrations of echo taking precedence.
+func collectRoutes(pkgs []*packages.Package) map[string]string {
+	routes := map[string]string{}
+	tableRoutes := map[string]string{}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Syntax {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if lit, ok := n.(*ast.CompositeLit); ok {
+					if fn, route, ok := tableRoute(pkg.TypesInfo, lit); ok {
+						if _, ok := tableRoutes[fn.FullName()]; !ok {
+							tableRoutes[fn.FullName()] = route
+						}
+					}
+					return true
+				}
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) < 2 {
+					return true
+				}
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok || !echoRouteMethods[sel.Sel.Name] || !isEchoRouter(pkg.TypesInfo.TypeOf(sel.X)) {
+					return true
+				}
+				lit, ok := call.Args[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return true
+				}
+				path, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					return true
+				}
+				fn := handlerFunc(pkg.TypesInfo, call.Args[1])
+				if fn == nil {
+					return true
+				}
+				if _, ok := routes[fn.FullName()]; !ok {
+					routes[fn.FullName()] = sel.Sel.Name + " " + path
+				}
+				return true
+			})
+		}
+	}
+	for fn, route := range tableRoutes {
+		if _, ok := routes[fn]; !ok {
+			routes[fn] = route
+		}
+	}
+	return routes
+}
+
+// tableRoute reports whether lit is a struct literal of a route table entry, holding a method
+// like "GET", a path starting with "/" and a handler, returning the handler and the route.
+func tableRoute(info *types.Info, lit *ast.CompositeLit) (*types.Func, string, bool) {
+	if t := info.TypeOf(lit); t == nil {
+		return nil, "", false
+	} else if _, ok := t.Underlying().(*types.Struct); !ok {
+		return nil, "", false
+	}
+	var method, path string
+	var handler *types.Func
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			elt = kv.Value
+		}
+		if tv := info.Types[elt]; tv.Value != nil && tv.Value.Kind() == constant.String {
+			switch s := constant.StringVal(tv.Value); {
+			case echoRouteMethods[s]:
+				method = s
+			case strings.HasPrefix(s, "/"):
+				path = s
+			}
+			continue
+		}
+		if fn := handlerFunc(info, elt); fn != nil {
+			handler = fn
+		}
+	}
+	if method == "" || path == "" || handler == nil {
+		return nil, "", false
+	}
+	return handler, method + " " + path, true
+}
+
+func isEchoRouter(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == echoPkgPath && (obj.Name() == "Echo" || obj.Name() == "Group")
+}
+
+// handlerFunc resolves a handler reference (h, pkg.H or a method value like s.H) to its function.
+func handlerFunc(info *types.Info, expr ast.Expr) *types.Func {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		fn, _ := info.Uses[x].(*types.Func)
+		return fn
+	case *ast.SelectorExpr:
+		if s, ok := info.Selections[x]; ok {
+			if s.Kind() != types.MethodVal {
+				return nil
+			}
+			fn, _ := s.Obj().(*types.Func)
+			return fn
+		}
+		fn, _ := info.Uses[x.Sel].(*types.Func)
+		return fn
+	}
+	return nil
+}
+
+// unusedHandlers reports the exported functions and methods of pkgs shaped like echo handlers,
+// func(echo.Context) error, that routes does not register. Handlers registered through a
+// wrapper, like e.GET("/", withAuth(h)), are reported too.
+func unusedHandlers(pkgs []*packages.Package, routes map[string]string) []string {
+	var findings []string
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Syntax {
+			for _, decl := range f.Decls {
+				x, ok := decl.(*ast.FuncDecl)
+				if !ok || !x.Name.IsExported() {
+					continue
+				}
+				fn, ok := pkg.TypesInfo.Defs[x.Name].(*types.Func)
+				if !ok || !isEchoHandler(fn.Type().(*types.Signature)) {
+					continue
+				}
+				if _, ok := routes[fn.FullName()]; !ok {
+					findings = append(findings, fmt.Sprintf("%s: handler %s is not registered to any route", pkg.Fset.Position(x.Pos()), fn.FullName()))
+				}
+			}
+		}
+	}
+	return findings
+}
+
+func isEchoHandler(sig *types.Signature) bool {
+	if sig.Params().Len() != 1 || sig.Results().Len() != 1 || sig.TypeParams().Len() > 0 {
+		return false
+	}
+	named, ok := sig.Params().At(0).Type().(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == echoPkgPath && obj.Name() == "Context" &&
+		types.Identical(sig.Results().At(0).Type(), types.Universe.Lookup("error").Type())
+}
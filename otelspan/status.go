@@ -0,0 +1,110 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// statusAttrKey is the attribute set to the status written to the response by -status-from-response.
+const statusAttrKey = "http.response.status_code"
+
+// echoResponseMethods are the methods of echo.Context writing a response with the status as their first arg.
+var echoResponseMethods = map[string]bool{
+	"Blob":       true,
+	"HTML":       true,
+	"HTMLBlob":   true,
+	"JSON":       true,
+	"JSONBlob":   true,
+	"JSONP":      true,
+	"JSONPBlob":  true,
+	"JSONPretty": true,
+	"NoContent":  true,
+	"Redirect":   true,
+	"Render":     true,
+	"Stream":     true,
+	"String":     true,
+	"XML":        true,
+	"XMLBlob":    true,
+	"XMLPretty":  true,
+}
+
+// writesStatus reports whether body writes a response with a status through the echo.Context param,
+// like c.JSON(http.StatusNotFound, ...).
+func writesStatus(body *ast.BlockStmt, param string) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return !found
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && isIdent(sel.X, param) && echoResponseMethods[sel.Sel.Name] {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// statusStmt returns a deferred func recording the status of the response written by the handler
+// on the span, as an error for a 5xx, when the span ends:
+//
+//	defer func() {
+//		if c.Response().Committed {
+//			span.SetAttributes(attribute.Int("http.response.status_code", c.Response().Status))
+//			if c.Response().Status >= 500 {
+//				span.SetStatus(codes.Error, "")
+//			}
+//		}
+//	}()
+//
+// A handler returning an error without writing a response leaves it uncommitted, the error
+// handler of echo writing it after the span ends.
+func statusStmt(param, attrPkg, codesPkg string) ast.Stmt {
+	response := func(field string) ast.Expr {
+		return &ast.SelectorExpr{
+			X:   &ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: param}, Sel: &ast.Ident{Name: "Response"}}},
+			Sel: &ast.Ident{Name: field},
+		}
+	}
+	spanCall := func(method string, args ...ast.Expr) ast.Stmt {
+		return &ast.ExprStmt{X: &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: method}},
+			Args: args,
+		}}
+	}
+	return &ast.DeferStmt{Call: &ast.CallExpr{Fun: &ast.FuncLit{
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.IfStmt{
+				Cond: response("Committed"),
+				Body: &ast.BlockStmt{List: []ast.Stmt{
+					spanCall("SetAttributes", attributeCall(attrPkg, "Int", statusAttrKey, response("Status"))),
+					&ast.IfStmt{
+						Cond: &ast.BinaryExpr{X: response("Status"), Op: token.GEQ, Y: &ast.BasicLit{Kind: token.INT, Value: "500"}},
+						Body: &ast.BlockStmt{List: []ast.Stmt{
+							spanCall("SetStatus",
+								&ast.SelectorExpr{X: &ast.Ident{Name: codesPkg}, Sel: &ast.Ident{Name: "Error"}},
+								&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote("")},
+							),
+						}},
+					},
+				}},
+			},
+		}},
+	}}}
+}
+
+// isStatusStmt reports whether stmt is the deferred func of statusStmt.
+func isStatusStmt(stmt ast.Stmt) bool {
+	d, ok := stmt.(*ast.DeferStmt)
+	if !ok {
+		return false
+	}
+	lit, ok := d.Call.Fun.(*ast.FuncLit)
+	if !ok || len(lit.Body.List) != 1 {
+		return false
+	}
+	ifStmt, ok := lit.Body.List[0].(*ast.IfStmt)
+	return ok && len(ifStmt.Body.List) > 0 && isSetAttributes(ifStmt.Body.List[0]) && setsAttr(ifStmt.Body.List[0], statusAttrKey)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// returnsOnlyError reports whether ftype has a single unnamed error result, so that its body can
+// be moved into a func() error literal without changing what its return statements mean.
+func returnsOnlyError(ftype *ast.FuncType) bool {
+	if ftype.Results == nil || len(ftype.Results.List) != 1 {
+		return false
+	}
+	result := ftype.Results.List[0]
+	return len(result.Names) == 0 && types.ExprString(result.Type) == "error"
+}
+
+// wrapBodyStmts returns stmts moved into a func literal whose error, assigned to errName, is
+// recorded on the span, the literal closed at rbrace, the closing brace of the body stmts are
+// moved from, so that the comments following stmts in it stay in the literal:
+//
+//	err := func() error {
+//		<stmts>
+//	}()
+//	if err != nil {
+//		span.RecordError(err)
+//		span.SetStatus(codes.Error, err.Error())
+//	}
+//	return err
+func wrapBodyStmts(stmts []ast.Stmt, codesPkg, errName string, rbrace token.Pos) []ast.Stmt {
+	errIdent := func() *ast.Ident {
+		return &ast.Ident{Name: errName}
+	}
+	spanCall := func(method string, args ...ast.Expr) ast.Stmt {
+		return &ast.ExprStmt{X: &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: method}},
+			Args: args,
+		}}
+	}
+	return []ast.Stmt{
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{errIdent()},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.CallExpr{
+				Fun: &ast.FuncLit{
+					Type: &ast.FuncType{
+						Params:  &ast.FieldList{},
+						Results: &ast.FieldList{List: []*ast.Field{{Type: &ast.Ident{Name: "error"}}}},
+					},
+					Body: &ast.BlockStmt{List: stmts, Rbrace: rbrace},
+				},
+				Lparen: rbrace,
+				Rparen: rbrace,
+			}},
+		},
+		&ast.IfStmt{
+			Cond: &ast.BinaryExpr{X: errIdent(), Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				spanCall("RecordError", errIdent()),
+				spanCall("SetStatus",
+					&ast.SelectorExpr{X: &ast.Ident{Name: codesPkg}, Sel: &ast.Ident{Name: "Error"}},
+					&ast.CallExpr{Fun: &ast.SelectorExpr{X: errIdent(), Sel: &ast.Ident{Name: "Error"}}},
+				),
+			}},
+		},
+		&ast.ReturnStmt{Results: []ast.Expr{errIdent()}},
+	}
+}
+
+// freeName returns name, or name suffixed by a number if needed, so that it is declared by neither
+// a param or result of ftype nor stmts, the statements preceding the one declaring it in the body.
+func freeName(ftype *ast.FuncType, stmts []ast.Stmt, name string) string {
+	declared := map[string]bool{}
+	for _, list := range []*ast.FieldList{ftype.Params, ftype.Results} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, n := range field.Names {
+				declared[n.Name] = true
+			}
+		}
+	}
+	for _, stmt := range stmts {
+		switch x := stmt.(type) {
+		case *ast.AssignStmt:
+			if x.Tok == token.DEFINE {
+				for _, lhs := range x.Lhs {
+					if ident, ok := lhs.(*ast.Ident); ok {
+						declared[ident.Name] = true
+					}
+				}
+			}
+		case *ast.DeclStmt:
+			if gen, ok := x.Decl.(*ast.GenDecl); ok {
+				for _, spec := range gen.Specs {
+					if vs, ok := spec.(*ast.ValueSpec); ok {
+						for _, n := range vs.Names {
+							declared[n.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	free := name
+	for i := 2; declared[free]; i++ {
+		free = fmt.Sprintf("%s%d", name, i)
+	}
+	return free
+}